@@ -0,0 +1,63 @@
+package hadoopfiles
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// The character encoding strings are written in.
+type Charset int
+
+const (
+	UTF8   Charset = iota // strings are written as is (default)
+	Latin1                // ISO-8859-1, for legacy consumers
+)
+
+// What to do with a rune that can't be represented in the output Charset.
+type UnrepresentableRunePolicy int
+
+const (
+	UnrepresentableError   UnrepresentableRunePolicy = iota // record an error (default)
+	UnrepresentableDrop                                     // omit the rune
+	UnrepresentableReplace                                  // write the replacement string instead
+)
+
+// Sets the character encoding strings are transcoded to before being written.
+// Escaping happens first, and escapes and delimiters are ASCII, so they're
+// unaffected. Runes the charset can't represent are handled according to
+// SetUnrepresentableRunePolicy. Binary and raw fields aren't transcoded.
+func (w *RowWriter) SetCharset(c Charset) {
+	w.charset = c
+}
+
+// Sets how runes that can't be represented in the output Charset are handled.
+// The default, UnrepresentableError, records an error (see Err) rather than
+// silently losing data. replacement is only used by UnrepresentableReplace and
+// must itself be representable, such as "?".
+func (w *RowWriter) SetUnrepresentableRunePolicy(p UnrepresentableRunePolicy, replacement string) {
+	w.runePolicy = p
+	w.runeReplacement = replacement
+}
+
+// Writes an escaped string in the output charset.
+func (w *RowWriter) writeEncoded(s string) {
+	if w.charset == UTF8 {
+		w.buf.WriteString(s)
+		return
+	}
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		if r < 0x100 && (r != utf8.RuneError || size > 1) {
+			w.buf.WriteByte(byte(r))
+			continue
+		}
+		switch w.runePolicy {
+		case UnrepresentableDrop:
+		case UnrepresentableReplace:
+			w.buf.WriteString(w.runeReplacement)
+		default:
+			w.setErr(fmt.Errorf("Rune %q is not representable in ISO-8859-1", r))
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package hadoopfiles
+
+import (
+	"testing"
+)
+
+func TestLatin1Charset(t *testing.T) {
+	const s = "café\x01€"
+	for _, c := range []struct {
+		policy   UnrepresentableRunePolicy
+		expected string
+		fails    bool
+	}{
+		{UnrepresentableError, "caf\xe9\\x01\x01\n", true},
+		{UnrepresentableDrop, "caf\xe9\\x01\x01\n", false},
+		{UnrepresentableReplace, "caf\xe9\\x01?\x01\n", false},
+	} {
+		f := NewRowWriter()
+		f.SetCharset(Latin1)
+		f.SetUnrepresentableRunePolicy(c.policy, "?")
+		f.WriteString(s)
+		if err := f.Err(); (err != nil) != c.fails {
+			t.Errorf("Policy %d: unexpected error: %v", c.policy, err)
+		}
+		if out := f.Row(); string(out) != c.expected {
+			t.Errorf("Policy %d: expected: %q !=\nActual:  %q", c.policy, c.expected, out)
+		}
+	}
+
+	// UTF-8 output is unchanged
+	f := NewRowWriter()
+	f.WriteString(s)
+	if out, expected := f.Row(), "café\\x01€\x01\n"; string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+}
@@ -0,0 +1,288 @@
+package hadoopfiles
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Quotes s as a HiveQL string literal.
+func hiveQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// Returns the HiveQL statement loading the file or directory at hdfsPath
+// into table, such as:
+//
+//	LOAD DATA INPATH '/tmp/part-00000' INTO TABLE logs PARTITION (dt='2014-01-02')
+//
+// The PARTITION clause is omitted if partition is empty. As a map has no
+// order, partition columns are listed sorted by name and must be in that
+// order in the table's PARTITIONED BY clause.
+func LoadDataStatement(table, hdfsPath string, partition map[string]string) string {
+	var b strings.Builder
+	b.WriteString("LOAD DATA INPATH ")
+	b.WriteString(hiveQuote(hdfsPath))
+	b.WriteString(" INTO TABLE ")
+	b.WriteString(table)
+	if len(partition) == 0 {
+		return b.String()
+	}
+
+	cols := make([]string, 0, len(partition))
+	for col := range partition {
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+	b.WriteString(" PARTITION (")
+	for i, col := range cols {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(col)
+		b.WriteByte('=')
+		b.WriteString(hiveQuote(partition[col]))
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// Returns the Hive type a value of type t is written as by WriteField: ints
+// become the integer type of the same size, uints the smallest type that
+// holds them, slices and arrays ARRAYs, maps MAPs, and structs STRUCTs of
+// their fields as WriteStruct writes them. Pointers and nullable wrappers such
+// as Nullable[T] have the type of the value they wrap.
+func HiveTypeOf(t reflect.Type) (HiveType, error) {
+	switch t {
+	case timeType:
+		return HiveTimestamp, nil
+	case rawJSONType, reflect.TypeOf(NullableString{}), reflect.TypeOf(big.Rat{}):
+		return HiveString, nil
+	}
+	if t.Kind() == reflect.Struct && t.Implements(nullableType) {
+		if f, ok := t.FieldByName("Value"); ok {
+			return HiveTypeOf(f.Type)
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return HiveTypeOf(t.Elem())
+	case reflect.String:
+		return HiveString, nil
+	case reflect.Bool:
+		return HiveBoolean, nil
+	case reflect.Int8:
+		return HiveTinyInt, nil
+	case reflect.Int16, reflect.Uint8:
+		return HiveSmallInt, nil
+	case reflect.Int32, reflect.Uint16:
+		return HiveInt, nil
+	case reflect.Int, reflect.Int64, reflect.Uint32:
+		return HiveBigInt, nil
+	case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		return "DECIMAL(20,0)", nil
+	case reflect.Float32:
+		return HiveFloat, nil
+	case reflect.Float64:
+		return HiveDouble, nil
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return HiveBinary, nil
+		}
+		elem, err := HiveTypeOf(t.Elem())
+		if err != nil {
+			return "", err
+		}
+		return "ARRAY<" + elem + ">", nil
+	case reflect.Map:
+		key, err := HiveTypeOf(t.Key())
+		if err != nil {
+			return "", err
+		}
+		value, err := HiveTypeOf(t.Elem())
+		if err != nil {
+			return "", err
+		}
+		return "MAP<" + key + "," + value + ">", nil
+	case reflect.Struct:
+		cols, err := structColumns(t)
+		if err != nil {
+			return "", err
+		}
+		fields := make([]string, len(cols))
+		for i, c := range cols {
+			fields[i] = c.Name + ":" + string(c.Type)
+		}
+		return HiveType("STRUCT<" + strings.Join(fields, ",") + ">"), nil
+	}
+	return "", fmt.Errorf("No Hive type for %v", t)
+}
+
+// Returns a column for each field of a struct type in the order WriteStruct
+// writes them, named by its lowercased field name.
+func structColumns(t reflect.Type) ([]Column, error) {
+	order, err := columnFields(t)
+	if err != nil {
+		return nil, err
+	}
+	var cols []Column
+	for _, i := range order {
+		f := t.Field(i)
+		typ, err := HiveTypeOf(f.Type)
+		if err != nil {
+			return nil, fmt.Errorf("Field %s: %v", f.Name, err)
+		}
+		cols = append(cols, Column{Name: strings.ToLower(f.Name), Type: typ})
+	}
+	return cols, nil
+}
+
+// Field orders of each struct type passed to columnFields.
+var columnFieldsCache sync.Map // reflect.Type -> []int
+
+// Returns the indexes of a struct type's fields in column order, as given by
+// fieldColumns, for writing rows and nested STRUCTs of the struct. Unlike
+// decoding, which ignores columns without a field, every column must have
+// exactly one field. The result is shared and must not be modified.
+func columnFields(t reflect.Type) ([]int, error) {
+	if order, ok := columnFieldsCache.Load(t); ok {
+		return order.([]int), nil
+	}
+	cols, err := fieldColumns(t)
+	if err != nil {
+		return nil, err
+	}
+	var order []int
+	for i, c := range cols {
+		if c < 0 {
+			continue
+		}
+		for len(order) <= c {
+			order = append(order, -1)
+		}
+		if order[c] >= 0 {
+			return nil, fmt.Errorf("Fields %s and %s both have column %d", t.Field(order[c]).Name, t.Field(i).Name, c)
+		}
+		order[c] = i
+	}
+	for c, i := range order {
+		if i < 0 {
+			return nil, fmt.Errorf("No field of %v for column %d", t, c)
+		}
+	}
+	columnFieldsCache.Store(t, order)
+	return order, nil
+}
+
+// Returns the ROW FORMAT clause of a CREATE TABLE statement for files written
+// by w, with its delimiters, escape character, and NULL token.
+func HiveDDLClause(w *RowWriter) string {
+	var b strings.Builder
+	b.WriteString("ROW FORMAT DELIMITED\n")
+	fmt.Fprintf(&b, "  FIELDS TERMINATED BY '\\%03o'\n", w.fieldDelimiter)
+	fmt.Fprintf(&b, "  COLLECTION ITEMS TERMINATED BY '\\%03o'\n", w.itemDelimiter)
+	fmt.Fprintf(&b, "  MAP KEYS TERMINATED BY '\\%03o'\n", w.mapKeyDelimiter)
+	if !w.noEscape {
+		b.WriteString("  ESCAPED BY '\\\\'\n")
+	}
+	fmt.Fprintf(&b, "  LINES TERMINATED BY '\\%03o'\n", w.lineEnding)
+	fmt.Fprintf(&b, "  NULL DEFINED AS %s", hiveQuote(w.nullString))
+	return b.String()
+}
+
+// Sets up a new table from a Go struct: its CREATE TABLE statement and a
+// RowWriter for writing instances of the struct, one per row, with
+// WriteStruct.
+type TableBuilder struct {
+	table  string
+	sample reflect.Type
+	delims Delimiters
+	null   string
+}
+
+// Creates a TableBuilder for a table whose rows are instances of sample's
+// struct type, with the default delimiters.
+func NewTableBuilder(table string, sample interface{}) *TableBuilder {
+	return &TableBuilder{table: table, sample: reflect.TypeOf(sample), delims: DefaultDelimiters}
+}
+
+// Sets the delimiters of the table and its writer.
+func (b *TableBuilder) SetDelimiters(d Delimiters) {
+	b.delims = d
+}
+
+// Sets the NULL token of the table and its writer. See SetNullString.
+func (b *TableBuilder) SetNullString(s string) {
+	b.null = s
+}
+
+// Returns the table's CREATE TABLE statement and a RowWriter configured to
+// match it. Returns an error if the sample isn't a struct (or a pointer to
+// one), a field has no Hive type, or the delimiters are invalid.
+func (b *TableBuilder) Build() (ddl string, writer *RowWriter, err error) {
+	t := b.sample
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return "", nil, fmt.Errorf("Table sample must be a struct: %v", b.sample)
+	}
+	cols, err := structColumns(t)
+	if err != nil {
+		return "", nil, err
+	}
+
+	schema := Schema{Columns: cols, Delimiters: b.delims, NullString: b.null}
+	w, err := schema.NewWriter()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return createTable("CREATE TABLE", b.table, cols, w), w, nil
+}
+
+// Returns a CREATE EXTERNAL TABLE statement for table with the schema's
+// columns and a ROW FORMAT clause matching w's delimiters, escaping, and NULL
+// token exactly, so Hive reads the files w writes as they were written. Use
+// the schema's NewWriter for w to keep both in step with the schema, and
+// Validate to check the column types first.
+func (s Schema) DDL(table string, w *RowWriter) string {
+	return createTable("CREATE EXTERNAL TABLE", table, s.Columns, w)
+}
+
+// Quotes s as a HiveQL identifier, so names such as reserved words can be
+// used as table and column names.
+func hiveQuoteIdent(s string) string {
+	return "`" + strings.ReplaceAll(s, "`", "``") + "`"
+}
+
+// Quotes a table name, which may be qualified with its database as in
+// db.table, as HiveQL identifiers.
+func hiveQuoteTable(table string) string {
+	parts := strings.Split(table, ".")
+	for i, p := range parts {
+		parts[i] = hiveQuoteIdent(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+// Returns a statement creating a text file table of columns written by w.
+func createTable(create, table string, cols []Column, w *RowWriter) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s (\n", create, hiveQuoteTable(table))
+	for i, c := range cols {
+		fmt.Fprintf(&sb, "  %s %s", hiveQuoteIdent(c.Name), c.Type)
+		if i < len(cols)-1 {
+			sb.WriteByte(',')
+		}
+		sb.WriteByte('\n')
+	}
+	sb.WriteString(")\n")
+	sb.WriteString(HiveDDLClause(w))
+	sb.WriteString("\nSTORED AS TEXTFILE")
+	return sb.String()
+}
@@ -0,0 +1,233 @@
+package hadoopfiles
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadDataStatement(t *testing.T) {
+	out := LoadDataStatement("logs", "/data/it's/part-00000", map[string]string{
+		"region": `us\east`,
+		"dt":     "2014-01-02",
+	})
+	expected := `LOAD DATA INPATH '/data/it\'s/part-00000' INTO TABLE logs PARTITION (dt='2014-01-02', region='us\\east')`
+	if out != expected {
+		t.Errorf("Expected: %s !=\nActual:   %s", expected, out)
+	}
+
+	out = LoadDataStatement("db.logs", "/data/logs", nil)
+	if expected := `LOAD DATA INPATH '/data/logs' INTO TABLE db.logs`; out != expected {
+		t.Errorf("Expected: %s !=\nActual:   %s", expected, out)
+	}
+}
+
+type testEvent struct {
+	ID      int64
+	Name    string
+	Tags    []string
+	Attrs   map[string]int
+	At      time.Time
+	Score   Nullable[float64]
+	Point   struct{ X, Y int32 }
+	private string
+}
+
+func TestTableBuilder(t *testing.T) {
+	b := NewTableBuilder("events", testEvent{})
+	b.SetNullString(`\N`)
+	ddl, w, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "CREATE TABLE `events` (\n" +
+		"  `id` BIGINT,\n" +
+		"  `name` STRING,\n" +
+		"  `tags` ARRAY<STRING>,\n" +
+		"  `attrs` MAP<STRING,BIGINT>,\n" +
+		"  `at` TIMESTAMP,\n" +
+		"  `score` DOUBLE,\n" +
+		"  `point` STRUCT<x:INT,y:INT>\n" +
+		`)
+ROW FORMAT DELIMITED
+  FIELDS TERMINATED BY '\001'
+  COLLECTION ITEMS TERMINATED BY '\002'
+  MAP KEYS TERMINATED BY '\003'
+  ESCAPED BY '\\'
+  LINES TERMINATED BY '\012'
+  NULL DEFINED AS '\\N'
+STORED AS TEXTFILE`
+	if ddl != expected {
+		t.Errorf("Expected:\n%s\nActual:\n%s", expected, ddl)
+	}
+
+	e := testEvent{
+		ID:    1,
+		Name:  "a\x01",
+		Tags:  []string{"x"},
+		Attrs: map[string]int{"k": 2},
+		At:    time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC),
+		Point: struct{ X, Y int32 }{3, 4},
+	}
+	if err := w.WriteStruct(&e); err != nil {
+		t.Fatal(err)
+	}
+	row := "1\x01a\\x01\x01x\x01k\x032\x012014-01-02 03:04:05\x01\\N\x013\x024\x01\n"
+	if out := w.Row(); string(out) != row {
+		t.Errorf("Expected: %q !=\nActual:  %q", row, out)
+	}
+
+	if _, _, err := NewTableBuilder("bad", 1).Build(); err == nil {
+		t.Error("Expected an error for a non-struct sample")
+	}
+	if _, _, err := NewTableBuilder("bad", struct{ C chan int }{}).Build(); err == nil {
+		t.Error("Expected an error for a field without a Hive type")
+	}
+}
+
+func TestHiveTypeOf(t *testing.T) {
+	for _, c := range []struct {
+		v        interface{}
+		expected HiveType
+	}{
+		{int8(0), HiveTinyInt},
+		{[]byte(nil), HiveBinary},
+		{(*string)(nil), HiveString},
+		{NullableString{}, HiveString},
+		{[][]bool{}, "ARRAY<ARRAY<BOOLEAN>>"},
+		{map[int32][]float32{}, "MAP<INT,ARRAY<FLOAT>>"},
+		{uint32(0), HiveBigInt},
+		{uint64(0), "DECIMAL(20,0)"},
+		{big.NewRat(1, 3), HiveString},
+	} {
+		typ, err := HiveTypeOf(reflect.TypeOf(c.v))
+		if err != nil {
+			t.Errorf("%T: %v", c.v, err)
+		} else if typ != c.expected {
+			t.Errorf("%T: expected %s but found %s", c.v, c.expected, typ)
+		}
+	}
+}
+
+func TestSchemaDDL(t *testing.T) {
+	schema := Schema{
+		Columns:    []Column{{"id", HiveBigInt}, {"price", "DECIMAL(10,2)"}, {"attrs", "MAP<STRING,ARRAY<INT>>"}},
+		Delimiters: Delimiters{Field: '\t', Item: ',', MapKey: ':', Line: '\n'},
+		NoEscaping: true,
+	}
+	w, err := schema.NewWriter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "CREATE EXTERNAL TABLE `prices` (\n" +
+		"  `id` BIGINT,\n" +
+		"  `price` DECIMAL(10,2),\n" +
+		"  `attrs` MAP<STRING,ARRAY<INT>>\n" +
+		`)
+ROW FORMAT DELIMITED
+  FIELDS TERMINATED BY '\011'
+  COLLECTION ITEMS TERMINATED BY '\054'
+  MAP KEYS TERMINATED BY '\072'
+  LINES TERMINATED BY '\012'
+  NULL DEFINED AS ''
+STORED AS TEXTFILE`
+	if ddl := schema.DDL("prices", w); ddl != expected {
+		t.Errorf("Expected:\n%s\nActual:\n%s", expected, ddl)
+	}
+}
+
+func TestTableBuilderTags(t *testing.T) {
+	type tagged struct {
+		B    string `hive:"1"`
+		Skip int    `hive:"-"`
+		A    int    `hive:"0"`
+	}
+	ddl, w, err := NewTableBuilder("tagged", tagged{}).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(ddl, "(\n  `a` BIGINT,\n  `b` STRING\n)") {
+		t.Errorf("Expected columns a and b in tag order:\n%s", ddl)
+	}
+	if err := w.WriteStruct(tagged{B: "b", Skip: 9, A: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if out, expected := w.Row(), "1\x01b\x01\n"; string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+
+	type gap struct {
+		A int `hive:"1"`
+	}
+	if _, _, err := NewTableBuilder("gap", gap{}).Build(); err == nil {
+		t.Error("Expected an error for a column without a field")
+	}
+}
+
+func TestWriteStructRollback(t *testing.T) {
+	w := NewRowWriter()
+	w.WriteString("a")
+	row := struct {
+		N int
+		V testValuer
+	}{1, testValuer{err: errors.New("boom")}}
+	if err := w.WriteStruct(row); err == nil {
+		t.Fatal("Expected an error from the failing field")
+	}
+	if err := w.Err(); err != nil {
+		t.Errorf("Expected the error to be cleared after rollback but found: %v", err)
+	}
+	if out, expected := w.Row(), "a\x01\n"; string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+}
+
+func TestSchemaDDLQuoting(t *testing.T) {
+	schema := Schema{Columns: []Column{{"date", HiveDate}, {"odd`name", HiveString}}}
+	w, err := schema.NewWriter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ddl := schema.DDL("db.my`table", w)
+	expected := "CREATE EXTERNAL TABLE `db`.`my``table` (\n  `date` DATE,\n  `odd``name` STRING\n)\n"
+	if !strings.HasPrefix(ddl, expected) {
+		t.Errorf("Expected prefix:\n%s\nActual:\n%s", expected, ddl)
+	}
+}
+
+func TestNestedStructTags(t *testing.T) {
+	type inner struct {
+		A    int
+		Skip int `hive:"-"`
+		B    string
+	}
+	type outer struct {
+		ID int
+		In inner
+	}
+	ddl, w, err := NewTableBuilder("nested", outer{}).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(ddl, "`in` STRUCT<a:BIGINT,b:STRING>") {
+		t.Errorf("Expected a STRUCT without the skipped field:\n%s", ddl)
+	}
+	in := outer{1, inner{A: 2, Skip: 3, B: "x"}}
+	if err := w.WriteStruct(in); err != nil {
+		t.Fatal(err)
+	}
+	row := w.Row()
+	if expected := "1\x012\x02x\x01\n"; string(row) != expected {
+		t.Fatalf("Expected: %q !=\nActual:  %q", expected, row)
+	}
+	var out outer
+	if err := NewRowReader().DecodeRow(row, &out); err != nil {
+		t.Fatal(err)
+	}
+	if in.In.Skip = 0; out != in {
+		t.Errorf("Expected: %+v !=\nActual:  %+v", in, out)
+	}
+}
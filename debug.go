@@ -0,0 +1,97 @@
+package hadoopfiles
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// How DebugRow renders delimiters.
+type DebugStyle int
+
+const (
+	DebugNamed   DebugStyle = iota // ⟨FS⟩, ⟨IS⟩, ⟨KS⟩, and ⟨LE⟩ (default)
+	DebugEscaped                   // Go-style hex escapes such as \x01
+	DebugPipe                      // | between fields, "," between items, ":" between keys and values
+)
+
+// Sets how DebugRow renders delimiters.
+func (w *RowWriter) SetDebugStyle(style DebugStyle) {
+	w.debugStyle = style
+}
+
+// Returns a human readable version of a row written by this writer for logs
+// and test failures, rendering delimiters according to SetDebugStyle. The
+// DebugPipe style omits the line ending.
+func (w *RowWriter) DebugRow(row []byte) string {
+	var names [4]string
+	switch w.debugStyle {
+	case DebugEscaped:
+		for i, d := range []byte{w.fieldDelimiter, w.itemDelimiter, w.mapKeyDelimiter, w.lineEnding} {
+			names[i] = fmt.Sprintf(`\x%02x`, d)
+		}
+	case DebugPipe:
+		names = [4]string{"|", ",", ":", ""}
+	default:
+		names = [4]string{"⟨FS⟩", "⟨IS⟩", "⟨KS⟩", "⟨LE⟩"}
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(row); i++ {
+		switch c := row[i]; c {
+		case '\\':
+			// Escaped bytes are data, not delimiters
+			b.WriteByte(c)
+			if i+1 < len(row) {
+				i++
+				b.WriteByte(row[i])
+			}
+		case w.fieldDelimiter:
+			b.WriteString(names[0])
+		case w.itemDelimiter:
+			b.WriteString(names[1])
+		case w.mapKeyDelimiter:
+			b.WriteString(names[2])
+		case w.lineEnding:
+			b.WriteString(names[3])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// Splits a row written by this writer into its fields with escapes decoded,
+// for inspecting wide rows one column at a time in logs and test failures.
+// Collections keep their item and map key delimiters. Fields that fail to
+// decode are returned as written. Meant for diagnostics, not reading data.
+func (w *RowWriter) DebugColumns(row []byte) []string {
+	row = bytes.TrimSuffix(row, []byte{w.lineEnding})
+	if w.position == DelimiterPrefix {
+		row = bytes.TrimPrefix(row, []byte{w.fieldDelimiter})
+		// splitFields expects every field to be followed by a delimiter
+		row = append(row[:len(row):len(row)], w.fieldDelimiter)
+	}
+	raw := splitFields(row, w.fieldDelimiter)
+	if w.noEscape {
+		// Backslashes aren't escapes so split on every delimiter.
+		raw = bytes.Split(row, []byte{w.fieldDelimiter})
+		if len(raw[len(raw)-1]) == 0 {
+			raw = raw[:len(raw)-1]
+		}
+	}
+
+	cols := make([]string, len(raw))
+	for i, f := range raw {
+		if w.noEscape {
+			cols[i] = string(f)
+			continue
+		}
+		col, err := unescape(f)
+		if err != nil {
+			col = string(f)
+		}
+		cols[i] = col
+	}
+	return cols
+}
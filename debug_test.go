@@ -0,0 +1,53 @@
+package hadoopfiles
+
+import (
+	"testing"
+)
+
+func TestDebugRow(t *testing.T) {
+	f := NewRowWriter()
+	f.WriteString("a\x01b")
+	f.WriteOrderedStrMap([]string{"k1", "k2"}, []string{"v1", "v2"})
+	row := f.Row()
+
+	for _, c := range []struct {
+		style    DebugStyle
+		expected string
+	}{
+		{DebugNamed, `a\x01b⟨FS⟩k1⟨KS⟩v1⟨IS⟩k2⟨KS⟩v2⟨FS⟩⟨LE⟩`},
+		{DebugEscaped, `a\x01b\x01k1\x03v1\x02k2\x03v2\x01\x0a`},
+		{DebugPipe, `a\x01b|k1:v1,k2:v2|`},
+	} {
+		f.SetDebugStyle(c.style)
+		if out := f.DebugRow(row); out != c.expected {
+			t.Errorf("Expected: %s !=\nActual:   %s", c.expected, out)
+		}
+	}
+}
+
+func TestDebugColumns(t *testing.T) {
+	f := NewRowWriter()
+	f.WriteString("a\x01b\\")
+	f.WriteInt(42)
+	f.WriteNull()
+	f.WriteStrArray([]string{"c", "d\ne"})
+	row := f.Row()
+
+	expected := []string{"a\x01b\\", "42", "", "c\x02d\ne"}
+	cols := f.DebugColumns(row)
+	if len(cols) != len(expected) {
+		t.Fatalf("Expected %d columns but found %d: %q", len(expected), len(cols), cols)
+	}
+	for i := range expected {
+		if cols[i] != expected[i] {
+			t.Errorf("Column %d: expected %q but found %q", i, expected[i], cols[i])
+		}
+	}
+
+	f.SetDelimiterPosition(DelimiterPrefix)
+	f.WriteString("x")
+	f.WriteString("y")
+	if cols := f.DebugColumns(f.Row()); len(cols) != 2 || cols[0] != "x" || cols[1] != "y" {
+		t.Errorf("Unexpected prefix columns: %q", cols)
+	}
+}
@@ -0,0 +1,536 @@
+package hadoopfiles
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Decodes a row into the struct pointed to by dst, following the conventions
+// RowWriter writes with. Columns map to exported fields in order, or to the
+// column given by a field's `hive:"N"` tag; a `hive:"-"` tag skips a field.
+// Ints, uints, floats, bools (TRUE/FALSE), time.Time (Hive timestamps or
+// dates, in the location set by SetLocation), []byte (base64), slices,
+// arrays, maps, and nested structs are supported. NULL fields, those
+// matching SetNullString's token, leave pointers, slices, maps, and nullable
+// wrappers such as Nullable[T] as NULL (their zero value), as do empty
+// fields of types such as numbers. Columns without a field are ignored.
+func (r *RowReader) DecodeRow(row []byte, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("Decode destination must be a non-nil pointer to a struct: %T", dst)
+	}
+	v = v.Elem()
+	fields, err := fieldDecoders(v.Type())
+	if err != nil {
+		return err
+	}
+	return r.decodeStruct(row, v, fields)
+}
+
+// Decodes a row into a struct using the fields from fieldDecoders.
+func (r *RowReader) decodeStruct(row []byte, v reflect.Value, fields []fieldDecoder) error {
+	raw, err := r.splitRow(row)
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		if f.col >= len(raw) {
+			continue
+		}
+		if err := f.decode(r, raw[f.col], v.Field(f.index)); err != nil {
+			return fmt.Errorf("Column %d (%s): %v", f.col, f.name, err)
+		}
+	}
+	return nil
+}
+
+// A struct field decoded from a column.
+type fieldDecoder struct {
+	index  int
+	col    int
+	name   string
+	decode func(r *RowReader, raw []byte, v reflect.Value) error
+}
+
+// Decoders of each struct type passed to fieldDecoders.
+var fieldDecodersCache sync.Map // reflect.Type -> []fieldDecoder
+
+// Returns a decoder for each field of a struct type with a column, as
+// fieldColumns maps them, so decoding a row needn't inspect the fields'
+// types. The result is shared and must not be modified.
+func fieldDecoders(t reflect.Type) ([]fieldDecoder, error) {
+	if fields, ok := fieldDecodersCache.Load(t); ok {
+		return fields.([]fieldDecoder), nil
+	}
+	cols, err := fieldColumns(t)
+	if err != nil {
+		return nil, err
+	}
+	var fields []fieldDecoder
+	for i, col := range cols {
+		if col >= 0 {
+			fields = append(fields, fieldDecoder{index: i, col: col, name: t.Field(i).Name, decode: columnDecoder(t.Field(i).Type)})
+		}
+	}
+	fieldDecodersCache.Store(t, fields)
+	return fields, nil
+}
+
+// Returns a function decoding a column into a value of type t as decodeValue
+// does. Primitive types are decoded directly; others use decodeValue.
+func columnDecoder(t reflect.Type) func(r *RowReader, raw []byte, v reflect.Value) error {
+	switch t.Kind() {
+	case reflect.String:
+		return func(r *RowReader, raw []byte, v reflect.Value) error {
+			if string(raw) == r.nullString {
+				v.SetString("")
+				return nil
+			}
+			s, err := r.unescape(raw)
+			if err != nil {
+				return err
+			}
+			v.SetString(s)
+			return nil
+		}
+	case reflect.Bool:
+		return func(r *RowReader, raw []byte, v reflect.Value) error {
+			if len(raw) == 0 || string(raw) == r.nullString {
+				v.SetBool(false)
+				return nil
+			}
+			b, err := strconv.ParseBool(string(raw))
+			if err != nil {
+				return fmt.Errorf("Invalid boolean %q", raw)
+			}
+			v.SetBool(b)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		bits := t.Bits()
+		return func(r *RowReader, raw []byte, v reflect.Value) error {
+			if len(raw) == 0 || string(raw) == r.nullString {
+				v.SetInt(0)
+				return nil
+			}
+			n, err := strconv.ParseInt(string(raw), 10, bits)
+			if err != nil {
+				return fmt.Errorf("Invalid integer %q", raw)
+			}
+			v.SetInt(n)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		bits := t.Bits()
+		return func(r *RowReader, raw []byte, v reflect.Value) error {
+			if len(raw) == 0 || string(raw) == r.nullString {
+				v.SetUint(0)
+				return nil
+			}
+			n, err := strconv.ParseUint(string(raw), 10, bits)
+			if err != nil {
+				return fmt.Errorf("Invalid unsigned integer %q", raw)
+			}
+			v.SetUint(n)
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		bits := t.Bits()
+		return func(r *RowReader, raw []byte, v reflect.Value) error {
+			if len(raw) == 0 || string(raw) == r.nullString {
+				v.SetFloat(0)
+				return nil
+			}
+			f, err := strconv.ParseFloat(string(raw), bits)
+			if err != nil {
+				return fmt.Errorf("Invalid float %q", raw)
+			}
+			v.SetFloat(f)
+			return nil
+		}
+	}
+	return func(r *RowReader, raw []byte, v reflect.Value) error {
+		return r.decodeValue(raw, v, 0)
+	}
+}
+
+// Parses a field as written by WriteStrArray. The field must be as read,
+// before unescaping, such as from LazyScanner.RawField. An empty field is
+// read as a nil array.
+func (r *RowReader) ReadStrArray(field []byte) ([]string, error) {
+	var a []string
+	err := r.readField(field, &a)
+	return a, err
+}
+
+// Parses a field as written by WriteIntArray. See ReadStrArray.
+func (r *RowReader) ReadIntArray(field []byte) ([]int, error) {
+	var a []int
+	err := r.readField(field, &a)
+	return a, err
+}
+
+// Parses a field as written by WriteFloatArray. See ReadStrArray.
+func (r *RowReader) ReadFloatArray(field []byte) ([]float64, error) {
+	var a []float64
+	err := r.readField(field, &a)
+	return a, err
+}
+
+// Parses a field as written by WriteBoolArray. See ReadStrArray.
+func (r *RowReader) ReadBoolArray(field []byte) ([]bool, error) {
+	var a []bool
+	err := r.readField(field, &a)
+	return a, err
+}
+
+// Parses a field as written by WriteStrIntMap. See ReadStrArray. An empty
+// field is read as a nil map.
+func (r *RowReader) ReadStrIntMap(field []byte) (map[string]int, error) {
+	var m map[string]int
+	err := r.readField(field, &m)
+	return m, err
+}
+
+// Parses a field as written by WriteStrStrMap. See ReadStrIntMap.
+func (r *RowReader) ReadStrStrMap(field []byte) (map[string]string, error) {
+	var m map[string]string
+	err := r.readField(field, &m)
+	return m, err
+}
+
+// Decodes an escaped field into the value dst points to.
+func (r *RowReader) readField(field []byte, dst interface{}) error {
+	return r.decodeValue(field, reflect.ValueOf(dst).Elem(), 0)
+}
+
+// Columns of each struct type passed to fieldColumns, so rows of the same type
+// aren't reflected on again.
+var fieldColumnsCache sync.Map // reflect.Type -> []int
+
+// Returns the column of each field of a struct type, or -1 for unexported
+// fields and those tagged `hive:"-"`. Fields are numbered in order, and a
+// `hive:"N"` tag sets the column of a field and the fields after it. The
+// result is shared and must not be modified.
+func fieldColumns(t reflect.Type) ([]int, error) {
+	if cols, ok := fieldColumnsCache.Load(t); ok {
+		return cols.([]int), nil
+	}
+	cols := make([]int, t.NumField())
+	next := 0
+	for i := range cols {
+		f := t.Field(i)
+		tag := f.Tag.Get("hive")
+		switch {
+		case !f.IsExported() || tag == "-":
+			cols[i] = -1
+			continue
+		case tag != "":
+			n, err := strconv.Atoi(tag)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("Invalid hive tag on field %s: %q", f.Name, tag)
+			}
+			next = n
+		}
+		cols[i] = next
+		next++
+	}
+	fieldColumnsCache.Store(t, cols)
+	return cols, nil
+}
+
+// Splits b on every unescaped delim, keeping empty elements, for collections
+// which unlike rows have no trailing delimiter.
+func (r *RowReader) splitItems(b []byte, delim byte) [][]byte {
+	if r.noEscape {
+		return bytes.Split(b, []byte{delim})
+	}
+	var items [][]byte
+	for {
+		i := indexUnescaped(b, delim)
+		if i < 0 {
+			return append(items, b)
+		}
+		items = append(items, b[:i])
+		b = b[i+1:]
+	}
+}
+
+// Returns the index of the first unescaped delim in b, or -1.
+func (r *RowReader) index(b []byte, delim byte) int {
+	if r.noEscape {
+		return bytes.IndexByte(b, delim)
+	}
+	return indexUnescaped(b, delim)
+}
+
+// Returns the delimiter used at a nesting level.
+func (r *RowReader) delimiter(level int) (byte, error) {
+	if level >= len(r.levels) {
+		return 0, fmt.Errorf("Value is nested deeper than the %d delimiter levels", len(r.levels))
+	}
+	return r.levels[level], nil
+}
+
+// Returns whether raw is NULL for a value of type t: the null token, or an
+// empty field of a type which can't be empty, such as a number.
+func (r *RowReader) isNull(raw []byte, t reflect.Type) bool {
+	if string(raw) == r.nullString {
+		return true
+	}
+	if len(raw) > 0 {
+		return false
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Interface, reflect.Slice, reflect.Array, reflect.Map:
+		return false
+	case reflect.Struct:
+		return t == timeType
+	}
+	return true
+}
+
+// Decodes raw, a value at a nesting level, into v.
+func (r *RowReader) decodeValue(raw []byte, v reflect.Value, level int) error {
+	t := v.Type()
+	null := r.isNull(raw, t)
+	if t.Kind() == reflect.Struct && t.Implements(nullableType) {
+		value, valid := v.FieldByName("Value"), v.FieldByName("Valid")
+		if value.IsValid() && valid.IsValid() && valid.Kind() == reflect.Bool {
+			if r.isNull(raw, value.Type()) {
+				v.Set(reflect.Zero(t))
+				return nil
+			}
+			valid.SetBool(true)
+			return r.decodeValue(raw, value, level)
+		}
+	}
+
+	switch t {
+	case timeType:
+		if null {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		s, err := r.unescape(raw)
+		if err != nil {
+			return err
+		}
+		ts, err := r.parseTimestamp(s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(ts))
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		if null {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		p := reflect.New(t.Elem())
+		if err := r.decodeValue(raw, p.Elem(), level); err != nil {
+			return err
+		}
+		v.Set(p)
+	case reflect.String:
+		if null {
+			v.SetString("")
+			return nil
+		}
+		s, err := r.unescape(raw)
+		if err != nil {
+			return err
+		}
+		v.SetString(s)
+	case reflect.Interface:
+		if t.NumMethod() > 0 {
+			return fmt.Errorf("Cannot decode into %v", t)
+		}
+		if null {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		s, err := r.unescape(raw)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(s))
+	case reflect.Bool:
+		if null {
+			v.SetBool(false)
+			return nil
+		}
+		b, err := strconv.ParseBool(string(raw))
+		if err != nil {
+			return fmt.Errorf("Invalid boolean %q", raw)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if null {
+			v.SetInt(0)
+			return nil
+		}
+		n, err := strconv.ParseInt(string(raw), 10, t.Bits())
+		if err != nil {
+			return fmt.Errorf("Invalid integer %q", raw)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if null {
+			v.SetUint(0)
+			return nil
+		}
+		n, err := strconv.ParseUint(string(raw), 10, t.Bits())
+		if err != nil {
+			return fmt.Errorf("Invalid unsigned integer %q", raw)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		if null {
+			v.SetFloat(0)
+			return nil
+		}
+		f, err := strconv.ParseFloat(string(raw), t.Bits())
+		if err != nil {
+			return fmt.Errorf("Invalid float %q", raw)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if null {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			s, err := r.unescape(raw)
+			if err != nil {
+				return err
+			}
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return fmt.Errorf("Invalid base64 %q", s)
+			}
+			v.SetBytes(b)
+			return nil
+		}
+		delim, err := r.delimiter(level + 1)
+		if err != nil {
+			return err
+		}
+		items := r.splitItems(raw, delim)
+		if len(raw) == 0 {
+			items = nil
+		}
+		s := reflect.MakeSlice(t, len(items), len(items))
+		for i, item := range items {
+			if err := r.decodeValue(item, s.Index(i), level+1); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+	case reflect.Array:
+		delim, err := r.delimiter(level + 1)
+		if err != nil {
+			return err
+		}
+		items := r.splitItems(raw, delim)
+		if null {
+			items = nil
+		}
+		if len(items) > v.Len() {
+			return fmt.Errorf("%d items don't fit in %v", len(items), t)
+		}
+		for i, item := range items {
+			if err := r.decodeValue(item, v.Index(i), level+1); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if null {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		itemDelim, err := r.delimiter(level + 1)
+		if err != nil {
+			return err
+		}
+		keyDelim, err := r.delimiter(level + 2)
+		if err != nil {
+			return err
+		}
+		m := reflect.MakeMap(t)
+		if len(raw) == 0 {
+			v.Set(m)
+			return nil
+		}
+		for _, entry := range r.splitItems(raw, itemDelim) {
+			i := r.index(entry, keyDelim)
+			if i < 0 {
+				return fmt.Errorf("Map entry without a key delimiter: %q", entry)
+			}
+			k, val := reflect.New(t.Key()).Elem(), reflect.New(t.Elem()).Elem()
+			if err := r.decodeValue(entry[:i], k, level+2); err != nil {
+				return err
+			}
+			if err := r.decodeValue(entry[i+1:], val, level+2); err != nil {
+				return err
+			}
+			m.SetMapIndex(k, val)
+		}
+		v.Set(m)
+	case reflect.Struct:
+		delim, err := r.delimiter(level + 1)
+		if err != nil {
+			return err
+		}
+		cols, err := fieldColumns(t)
+		if err != nil {
+			return err
+		}
+		items := r.splitItems(raw, delim)
+		for i, col := range cols {
+			if col < 0 || col >= len(items) {
+				continue
+			}
+			if err := r.decodeValue(items[col], v.Field(i), level+1); err != nil {
+				return fmt.Errorf("Field %s: %v", t.Field(i).Name, err)
+			}
+		}
+	default:
+		return fmt.Errorf("Cannot decode into %v", t)
+	}
+	return nil
+}
+
+// Parses a Hive timestamp or date, as written by RowWriter, or one of the
+// layouts set with SetTimestampLayouts, in the reader's location.
+func (r *RowReader) parseTimestamp(s string) (time.Time, error) {
+	loc := r.location
+	if loc == nil {
+		loc = time.UTC
+	}
+	layout := TimestampFormat
+	if !strings.Contains(s, ":") {
+		layout = DateFormat
+	}
+	if ts, err := time.ParseInLocation(layout, s, loc); err == nil {
+		return ts, nil
+	}
+	for _, layout := range r.timestampLayouts {
+		if ts, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return ts, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Invalid timestamp %q", s)
+}
@@ -0,0 +1,208 @@
+package hadoopfiles
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testDecodeRow struct {
+	ID     int64
+	Name   string
+	Score  float64
+	Active bool
+	At     time.Time
+	Tags   []string
+	Counts map[string]int
+	Data   []byte
+	Point  struct{ X, Y int }
+	Note   *string
+	Rank   Nullable[int]
+	Grid   [][]int
+	skip   int
+}
+
+func TestDecodeRow(t *testing.T) {
+	note := "n\x01"
+	in := testDecodeRow{
+		ID:     -42,
+		Name:   "a\x01b\\",
+		Score:  1.5,
+		Active: true,
+		At:     time.Date(2014, 1, 2, 3, 4, 5, 600000000, time.UTC),
+		Tags:   []string{"x", "", "y\x02"},
+		Counts: map[string]int{"k\x03": 1},
+		Data:   []byte{0, 1, 0xff},
+		Point:  struct{ X, Y int }{3, 4},
+		Note:   &note,
+		Rank:   Nullable[int]{},
+		Grid:   [][]int{{1, 2}, {3}},
+	}
+	w := NewRowWriter()
+	if err := w.WriteStruct(in); err != nil {
+		t.Fatal(err)
+	}
+	row := w.Row()
+
+	var out testDecodeRow
+	if err := NewRowReader().DecodeRow(row, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("Expected: %+v !=\nActual:   %+v", in, out)
+	}
+
+	var empty testDecodeRow
+	if err := NewRowReader().DecodeRow([]byte("1\x01\x01\x01\x01\x01"), &empty); err != nil {
+		t.Fatal(err)
+	}
+	if empty.ID != 1 || empty.Tags != nil || empty.Note != nil || empty.Rank.Valid {
+		t.Errorf("Expected empty fields to decode as NULL: %+v", empty)
+	}
+}
+
+func TestDecodeRowTags(t *testing.T) {
+	var dst struct {
+		C    string `hive:"2"`
+		D    int
+		A    string `hive:"0"`
+		Skip string `hive:"-"`
+	}
+	if err := NewRowReader().DecodeRow([]byte("a\x01b\x01c\x013\x01\n"), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.A != "a" || dst.C != "c" || dst.D != 3 || dst.Skip != "" {
+		t.Errorf("Unexpected decoded struct: %+v", dst)
+	}
+
+	if err := NewRowReader().DecodeRow([]byte("x\x01"), &struct{ N int }{}); err == nil {
+		t.Error("Expected an error decoding a non-integer")
+	}
+	if err := NewRowReader().DecodeRow([]byte("x\x01"), struct{}{}); err == nil {
+		t.Error("Expected an error for a non-pointer destination")
+	}
+}
+
+func TestReadCollections(t *testing.T) {
+	w := NewRowWriter()
+	w.WriteStrArray([]string{"a\x02b", "", "c"})
+	w.WriteIntArray([]int{1, -2})
+	w.WriteFloatArray([]float64{1.5})
+	w.WriteBoolArray([]bool{true, false})
+	w.WriteStrIntMap(map[string]int{"x\x03": 1, "y": 2})
+	w.WriteStrStrMap(map[string]string{"k": "v\x02"})
+	w.WriteStrArray(nil)
+
+	sc := NewLazyScanner(bytes.NewReader(w.Row()))
+	if !sc.Scan() {
+		t.Fatal(sc.Err())
+	}
+	r := sc.RowReader
+	strs, err := r.ReadStrArray(sc.RawField(0))
+	if err != nil || !reflect.DeepEqual(strs, []string{"a\x02b", "", "c"}) {
+		t.Errorf("Unexpected string array %q: %v", strs, err)
+	}
+	ints, err := r.ReadIntArray(sc.RawField(1))
+	if err != nil || !reflect.DeepEqual(ints, []int{1, -2}) {
+		t.Errorf("Unexpected int array %v: %v", ints, err)
+	}
+	floats, err := r.ReadFloatArray(sc.RawField(2))
+	if err != nil || !reflect.DeepEqual(floats, []float64{1.5}) {
+		t.Errorf("Unexpected float array %v: %v", floats, err)
+	}
+	bools, err := r.ReadBoolArray(sc.RawField(3))
+	if err != nil || !reflect.DeepEqual(bools, []bool{true, false}) {
+		t.Errorf("Unexpected bool array %v: %v", bools, err)
+	}
+	m, err := r.ReadStrIntMap(sc.RawField(4))
+	if err != nil || !reflect.DeepEqual(m, map[string]int{"x\x03": 1, "y": 2}) {
+		t.Errorf("Unexpected string int map %v: %v", m, err)
+	}
+	sm, err := r.ReadStrStrMap(sc.RawField(5))
+	if err != nil || !reflect.DeepEqual(sm, map[string]string{"k": "v\x02"}) {
+		t.Errorf("Unexpected string map %v: %v", sm, err)
+	}
+	if empty, err := r.ReadStrArray(sc.RawField(6)); err != nil || empty != nil {
+		t.Errorf("Expected a nil array but found %q: %v", empty, err)
+	}
+	if _, err := r.ReadIntArray([]byte("1\x02x")); err == nil {
+		t.Error("Expected an error for an invalid integer")
+	}
+}
+
+func TestDecodeNullString(t *testing.T) {
+	var dst struct {
+		Empty   string
+		Null    *string
+		N       Nullable[int]
+		Missing int
+		Tags    []string
+		Items   []*int
+		Map     map[string]int
+	}
+	r := NewRowReader()
+	r.SetNullString(`\N`)
+	row := []byte("\x01\\N\x01\\N\x01\x01\x01\\N\x021\x01\x01")
+	if err := r.DecodeRow(row, &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Empty != "" || dst.Null != nil || dst.N.Valid || dst.Missing != 0 {
+		t.Errorf("Expected NULL scalars: %+v", dst)
+	}
+	if dst.Tags == nil || len(dst.Tags) != 0 || dst.Map == nil || len(dst.Map) != 0 {
+		t.Errorf("Expected empty, non-NULL collections: %+v", dst)
+	}
+	if len(dst.Items) != 2 || dst.Items[0] != nil || *dst.Items[1] != 1 {
+		t.Errorf("Expected a NULL and a 1 element: %v", dst.Items)
+	}
+
+	values, err := r.ReadTypedRow([]byte("\\N\x01\x01"), []HiveType{HiveString, HiveString})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(values, []interface{}{nil, ""}) {
+		t.Errorf("Expected a NULL and an empty string: %#v", values)
+	}
+}
+
+func TestDecodeTimestampLocation(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Skip(err)
+	}
+	r := NewRowReader()
+	r.SetLocation(la)
+	r.SetTimestampLayouts(time.RFC3339, "01/02/2006")
+	var dst struct{ A, B, C time.Time }
+	if err := r.DecodeRow([]byte("2014-01-02 03:04:05\x012014-01-02T03:04:05Z\x0101/02/2014\x01"), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if expected := time.Date(2014, 1, 2, 3, 4, 5, 0, la); !dst.A.Equal(expected) || dst.A.Location() != la {
+		t.Errorf("Expected %v but found %v", expected, dst.A)
+	}
+	if expected := time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC); !dst.B.Equal(expected) {
+		t.Errorf("Expected %v but found %v", expected, dst.B)
+	}
+	if expected := time.Date(2014, 1, 2, 0, 0, 0, 0, la); !dst.C.Equal(expected) {
+		t.Errorf("Expected %v but found %v", expected, dst.C)
+	}
+	if err := r.DecodeRow([]byte("Jan 2\x01"), &dst); err == nil {
+		t.Error("Expected an error for an unknown layout")
+	}
+}
+
+func BenchmarkDecodeRow(b *testing.B) {
+	w := NewRowWriter()
+	w.WriteStruct(testDecoderRow{"name", 42, []string{"x", "y"}})
+	row := w.Row()
+	r := NewRowReader()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var out testDecoderRow
+		if err := r.DecodeRow(row, &out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
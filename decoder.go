@@ -0,0 +1,90 @@
+package hadoopfiles
+
+import (
+	"fmt"
+	"io"
+	"iter"
+	"reflect"
+)
+
+// Decodes rows from an io.Reader into values of the struct type T, as
+// RowReader.DecodeRow does. T's fields are mapped to columns, and a decoder
+// chosen for each field's type, once when the Decoder is created rather than
+// for every row.
+type Decoder[T any] struct {
+	sc     *Scanner
+	fields []fieldDecoder
+}
+
+// Creates a Decoder reading rows delimited by delims from r, or by
+// DefaultDelimiters if delims is the zero value. Returns an error if T isn't
+// a struct, its hive tags are invalid, or delims are invalid.
+func NewDecoder[T any](r io.Reader, delims Delimiters) (*Decoder[T], error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("Decoder type must be a struct: %v", t)
+	}
+	fields, err := fieldDecoders(t)
+	if err != nil {
+		return nil, err
+	}
+	if delims == (Delimiters{}) {
+		delims = DefaultDelimiters
+	}
+	sc := NewScanner(r)
+	if err := sc.SetDelimiters(delims.Field, delims.Item, delims.MapKey, delims.Line); err != nil {
+		return nil, err
+	}
+	return &Decoder[T]{sc: sc, fields: fields}, nil
+}
+
+// Returns the Scanner rows are read with, for configuring it before the
+// first call to Next.
+func (d *Decoder[T]) Scanner() *Scanner {
+	return d.sc
+}
+
+// Decodes the next row. Returns io.EOF when there are no more rows. Rows that
+// can't be decoded are handled according to the Scanner's BadRowPolicy:
+// either an error is returned, the row is skipped, or the zero value of T is
+// returned in its place.
+func (d *Decoder[T]) Next() (T, error) {
+	for {
+		var v T
+		row, ok := d.sc.nextRow()
+		if !ok {
+			if err := d.sc.Err(); err != nil {
+				return v, err
+			}
+			return v, io.EOF
+		}
+		err := d.sc.decodeStruct(row, reflect.ValueOf(&v).Elem(), d.fields)
+		if err == nil {
+			return v, nil
+		}
+		var zero T
+		if !d.sc.badRow() {
+			return zero, err
+		}
+		if d.sc.badRowPolicy == ReplaceWithNulls {
+			return zero, nil
+		}
+	}
+}
+
+// Returns an iterator over the remaining rows, decoded as Next does, for use
+// with range. Iteration continues past rows that fail to decode, yielding
+// their errors, and stops at the end of the input or on a read error.
+func (d *Decoder[T]) All() iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for {
+			v, err := d.Next()
+			if err == io.EOF || !yield(v, err) {
+				return
+			}
+			if err != nil && d.sc.Err() != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package hadoopfiles
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testDecoderRow struct {
+	Name string
+	N    int
+	Tags []string
+}
+
+func TestDecoder(t *testing.T) {
+	rows := []testDecoderRow{
+		{"a|b", 1, []string{"x", "y"}},
+		{"", -2, nil},
+		{"c\n", 3, []string{"z"}},
+	}
+	w := NewRowWriter()
+	if err := w.SetDelimiters('|', ',', ':', '\n'); err != nil {
+		t.Fatal(err)
+	}
+	var data bytes.Buffer
+	for _, row := range rows {
+		if err := w.WriteStruct(row); err != nil {
+			t.Fatal(err)
+		}
+		data.Write(w.Row())
+	}
+
+	dec, err := NewDecoder[testDecoderRow](&data, Delimiters{Field: '|', Item: ',', MapKey: ':', Line: '\n'})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range rows {
+		row, err := dec.Next()
+		if err != nil {
+			t.Fatalf("Row %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(row, expected) {
+			t.Errorf("Row %d expected: %+v !=\nActual:  %+v", i, expected, row)
+		}
+	}
+	if _, err := dec.Next(); err != io.EOF {
+		t.Errorf("Expected io.EOF but found: %v", err)
+	}
+
+	if _, err := NewDecoder[int](strings.NewReader(""), DefaultDelimiters); err == nil {
+		t.Error("Expected an error for a non-struct type")
+	}
+	dec2, _ := NewDecoder[testDecoderRow](strings.NewReader("a|x|\n"), Delimiters{Field: '|', Item: ',', MapKey: ':', Line: '\n'})
+	if _, err := dec2.Next(); err == nil {
+		t.Error("Expected an error decoding an invalid integer")
+	}
+
+	// Zero delimiters are the defaults
+	type typed struct {
+		S  string
+		B  bool
+		I8 int8
+		U  uint16
+		F  float32
+		P  *int
+	}
+	dec3, err := NewDecoder[typed](strings.NewReader("a\\x01b\x01TRUE\x01-8\x0116\x011.5\x01\\N\x01\n\\N\x01\x01\x01\x01\x01\x01\n"), Delimiters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec3.Scanner().SetNullString(`\N`)
+	for i, expected := range []typed{{"a\x01b", true, -8, 16, 1.5, nil}, {}} {
+		row, err := dec3.Next()
+		if err != nil {
+			t.Fatalf("Row %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(row, expected) {
+			t.Errorf("Row %d expected: %+v !=\nActual:  %+v", i, expected, row)
+		}
+	}
+	dec4, _ := NewDecoder[typed](strings.NewReader("a\x01TRUE\x01128\x01\n"), Delimiters{})
+	if _, err := dec4.Next(); err == nil || !strings.Contains(err.Error(), "Column 2 (I8)") {
+		t.Errorf("Expected an error decoding an out of range integer but found: %v", err)
+	}
+}
+
+func TestDecoderBadRowPolicy(t *testing.T) {
+	type row struct{ N int }
+	data := "1\x01\nx\x01\n3\x01\n"
+	for _, tc := range []struct {
+		policy   BadRowPolicy
+		expected []row
+	}{
+		{SkipBadRow, []row{{1}, {3}}},
+		{ReplaceWithNulls, []row{{1}, {0}, {3}}},
+	} {
+		dec, err := NewDecoder[row](strings.NewReader(data), DefaultDelimiters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dec.Scanner().SetBadRowPolicy(tc.policy)
+		var rows []row
+		for {
+			r, err := dec.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			rows = append(rows, r)
+		}
+		if !reflect.DeepEqual(rows, tc.expected) {
+			t.Errorf("Policy %d expected: %v != %v", tc.policy, tc.expected, rows)
+		}
+		if n := dec.Scanner().BadRows(); n != 1 {
+			t.Errorf("Policy %d expected 1 bad row but found %d", tc.policy, n)
+		}
+	}
+}
+
+func TestDecoderAll(t *testing.T) {
+	type row struct{ N int }
+	dec, err := NewDecoder[row](strings.NewReader("1\x01\nx\x01\n3\x01\n"), DefaultDelimiters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []row
+	var errs int
+	for r, err := range dec.All() {
+		if err != nil {
+			errs++
+			continue
+		}
+		rows = append(rows, r)
+	}
+	if !reflect.DeepEqual(rows, []row{{1}, {3}}) || errs != 1 {
+		t.Errorf("Expected 2 rows and 1 error but found %v and %d errors", rows, errs)
+	}
+}
@@ -0,0 +1,87 @@
+package hadoopfiles
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Returned when reading a Snappy compressed file, which isn't supported as
+// decoding Snappy needs a package outside the standard library. Such files
+// must be decompressed before they're read, such as with hadoop fs -text.
+var ErrSnappyUnsupported = errors.New("Snappy compressed files are unsupported")
+
+var (
+	gzipMagic        = []byte{0x1f, 0x8b}
+	bzip2BlockMagic  = []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}
+	bzip2EndMagic    = []byte{0x17, 0x72, 0x45, 0x38, 0x50, 0x90}
+	snappyFrameMagic = []byte("\xff\x06\x00\x00sNaPpY")
+)
+
+// Returns a reader of r's contents, decompressing them if they're gzip or
+// bzip2 compressed, as detected by their magic bytes. Concatenated gzip
+// members, as Hadoop writes, are read as one stream. Returns
+// ErrSnappyUnsupported for framed Snappy streams. NewScanner reads its input
+// as is, so wrap compressed input with Decompress or use OpenScanner.
+func Decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(snappyFrameMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	case isBzip2(magic):
+		return bzip2.NewReader(br), nil
+	case bytes.HasPrefix(magic, snappyFrameMagic):
+		return nil, ErrSnappyUnsupported
+	}
+	return br, nil
+}
+
+// Returns whether b starts with a bzip2 stream header: "BZh", the block size,
+// and the magic of either a block or the end of the stream.
+func isBzip2(b []byte) bool {
+	if len(b) < 10 || string(b[:3]) != "BZh" || b[3] < '1' || b[3] > '9' {
+		return false
+	}
+	return bytes.Equal(b[4:10], bzip2BlockMagic) || bytes.Equal(b[4:10], bzip2EndMagic)
+}
+
+// Opens a file for scanning, decompressing it as Decompress does; unlike
+// NewScanner, compression is detected. Hadoop's Snappy codec has no magic
+// bytes, so files with a .snappy extension are rejected with
+// ErrSnappyUnsupported. Close the Scanner when done.
+func OpenScanner(name string) (*Scanner, error) {
+	if strings.EqualFold(filepath.Ext(name), ".snappy") {
+		return nil, ErrSnappyUnsupported
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	r, err := Decompress(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	sc := NewScanner(r)
+	sc.closer = f
+	return sc, nil
+}
+
+// Closes the file opened by OpenScanner. Does nothing for Scanners created
+// with NewScanner.
+func (sc *Scanner) Close() error {
+	if sc.closer == nil {
+		return nil
+	}
+	return sc.closer.Close()
+}
@@ -0,0 +1,75 @@
+package hadoopfiles
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecompress(t *testing.T) {
+	plain := "a\x01b\x01\nc\x01\n"
+	var gz bytes.Buffer
+	for _, part := range []string{"a\x01b\x01\n", "c\x01\n"} {
+		// Hadoop writes concatenated gzip members
+		zw := gzip.NewWriter(&gz)
+		zw.Write([]byte(part))
+		zw.Close()
+	}
+	bz2, err := os.ReadFile(filepath.Join("testdata", "rows.bz2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string][]byte{"plain": []byte(plain), "gzip": gz.Bytes(), "bzip2": bz2} {
+		r, err := Decompress(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		b, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if string(b) != plain {
+			t.Errorf("%s expected: %q != %q", name, plain, b)
+		}
+	}
+
+	if _, err := Decompress(bytes.NewReader(snappyFrameMagic)); err != ErrSnappyUnsupported {
+		t.Errorf("Expected ErrSnappyUnsupported but found: %v", err)
+	}
+	if r, err := Decompress(strings.NewReader("")); err != nil {
+		t.Error(err)
+	} else if b, _ := io.ReadAll(r); len(b) != 0 {
+		t.Errorf("Expected no data but found: %q", b)
+	}
+}
+
+func TestOpenScanner(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "rows.gz")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := gzip.NewWriter(f)
+	zw.Write(NewRowWriter().WriteStringRow([]string{"x", "y"}))
+	zw.Close()
+	f.Close()
+
+	sc, err := OpenScanner(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+	if !sc.Scan() || !reflect.DeepEqual(sc.Fields(), []string{"x", "y"}) {
+		t.Errorf("Unexpected fields %q: %v", sc.Fields(), sc.Err())
+	}
+
+	if _, err := OpenScanner("rows.snappy"); err != ErrSnappyUnsupported {
+		t.Errorf("Expected ErrSnappyUnsupported but found: %v", err)
+	}
+}
@@ -1,17 +1,36 @@
 package hadoopfiles
 
 import (
+	"bytes"
+	"fmt"
 	"strconv"
 	"unicode/utf8"
 )
 
 const lowerhex = "0123456789abcdef"
 
+// Precomputed escapes for the ASCII range to avoid strconv.IsPrint.
+var asciiEscapes [utf8.RuneSelf]string
+
+func init() {
+	for i := range asciiEscapes {
+		asciiEscapes[i] = escapeRune(rune(i))
+	}
+}
+
 // Returns an escaped version of rune. Escaping letters that produce control
 // codes (n => \n) will produce undesirable results.
+func escape(r rune) string {
+	if r >= 0 && r < utf8.RuneSelf {
+		return asciiEscapes[r]
+	}
+	return escapeRune(r)
+}
+
+// Slow path for escape.
 //
 // Modified version of strconv/quote.go:quoteWith
-func escape(r rune) string {
+func escapeRune(r rune) string {
 	if r == utf8.RuneError {
 		return `\uFFFD`
 	}
@@ -61,3 +80,116 @@ func escape(r rune) string {
 		}
 	}
 }
+
+// Reverses the escaping RowWriter applies to string fields: backslash escaped
+// delimiters and backslashes (\\, \,), Go-style escapes such as \n, and
+// \xNN, \uNNNN, and \UNNNNNNNN sequences. Use it to repair fields extracted
+// from rows without a RowReader.
+func Unescape(s string) (string, error) {
+	return unescape([]byte(s))
+}
+
+// Like Unescape but for a []byte. The result doesn't share memory with b.
+func UnescapeBytes(b []byte) ([]byte, error) {
+	return appendUnescaped(make([]byte, 0, len(b)), b)
+}
+
+// Reverses escape for every escape sequence in s.
+func unescape(s []byte) (string, error) {
+	if bytes.IndexByte(s, '\\') < 0 {
+		return string(s), nil
+	}
+	buf, err := appendUnescaped(make([]byte, 0, len(s)), s)
+	if err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// Appends s to buf with every escape sequence reversed.
+func appendUnescaped(buf, s []byte) ([]byte, error) {
+	i := bytes.IndexByte(s, '\\')
+	if i < 0 {
+		return append(buf, s...), nil
+	}
+	buf = append(buf, s[:i]...)
+	for ; i < len(s); i++ {
+		if s[i] != '\\' {
+			buf = append(buf, s[i])
+			continue
+		}
+		i++
+		if i == len(s) {
+			return nil, fmt.Errorf("Trailing backslash in %q", s)
+		}
+		switch c := s[i]; c {
+		case 'a':
+			buf = append(buf, '\a')
+		case 'b':
+			buf = append(buf, '\b')
+		case 'f':
+			buf = append(buf, '\f')
+		case 'n':
+			buf = append(buf, '\n')
+		case 'r':
+			buf = append(buf, '\r')
+		case 't':
+			buf = append(buf, '\t')
+		case 'v':
+			buf = append(buf, '\v')
+		case 'x', 'u', 'U':
+			n := 2 // hex digits
+			if c == 'u' {
+				n = 4
+			} else if c == 'U' {
+				n = 8
+			}
+			if i+n >= len(s) {
+				return nil, fmt.Errorf("Truncated \\%c escape in %q", c, s)
+			}
+			v, err := strconv.ParseUint(string(s[i+1:i+1+n]), 16, 32)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid \\%c escape in %q", c, s)
+			}
+			if c == 'x' {
+				buf = append(buf, byte(v))
+			} else {
+				buf = utf8.AppendRune(buf, rune(v))
+			}
+			i += n
+		default:
+			// Escaped backslash or delimiter
+			buf = append(buf, c)
+		}
+	}
+	return buf, nil
+}
+
+// Returns the index of the first c in b that isn't escaped, or -1.
+func indexUnescaped(b []byte, c byte) int {
+	for i := 0; i < len(b); i++ {
+		switch b[i] {
+		case '\\':
+			i++
+		case c:
+			return i
+		}
+	}
+	return -1
+}
+
+// Splits a row (without its line ending) on unescaped delim. Every field is
+// followed by a delimiter, so a trailing empty field is dropped.
+func splitFields(row []byte, delim byte) [][]byte {
+	var fields [][]byte
+	for len(row) > 0 {
+		i := indexUnescaped(row, delim)
+		if i < 0 {
+			fields = append(fields, row)
+			break
+		}
+		fields = append(fields, row[:i])
+		row = row[i+1:]
+	}
+	return fields
+}
@@ -0,0 +1,73 @@
+package hadoopfiles
+
+import (
+	"testing"
+)
+
+func TestEscapeASCII(t *testing.T) {
+	for i := 0; i < 256; i++ {
+		r := rune(i)
+		if got, expected := escape(r), escapeRune(r); got != expected {
+			t.Errorf("escape(%q) = %q but expected %q", r, got, expected)
+		}
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == 'U' {
+			// Ambiguous escapes which is why these can't be delimiters
+			continue
+		}
+		out, err := unescape([]byte(escape(r)))
+		if err != nil {
+			t.Fatalf("unescape(escape(%q)) failed: %v", r, err)
+		}
+		if out != string(r) {
+			t.Errorf("unescape(escape(%q)) = %q", r, out)
+		}
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	for _, c := range []struct {
+		in, expected string
+	}{
+		{"plain", "plain"},
+		{`a\\b`, `a\b`},
+		{`a\,b\|c`, "a,b|c"},
+		{`\x01\n\t`, "\x01\n\t"},
+		{`\u00e9\U0001f600`, "\u00e9\U0001f600"},
+	} {
+		out, err := Unescape(c.in)
+		if err != nil {
+			t.Errorf("Unescape(%q) failed: %v", c.in, err)
+		} else if out != c.expected {
+			t.Errorf("Unescape(%q) = %q; expected %q", c.in, out, c.expected)
+		}
+		b, err := UnescapeBytes([]byte(c.in))
+		if err != nil || string(b) != c.expected {
+			t.Errorf("UnescapeBytes(%q) = %q, %v; expected %q", c.in, b, err, c.expected)
+		}
+	}
+
+	for _, bad := range []string{`trailing\`, `\x0`, `\xzz`, `\u12`} {
+		if _, err := Unescape(bad); err == nil {
+			t.Errorf("Expected Unescape(%q) to fail", bad)
+		}
+		if _, err := UnescapeBytes([]byte(bad)); err == nil {
+			t.Errorf("Expected UnescapeBytes(%q) to fail", bad)
+		}
+	}
+}
+
+func BenchmarkEscapeASCII(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		for r := rune(0); r < 128; r++ {
+			escape(r)
+		}
+	}
+}
+
+func BenchmarkEscapeRuneASCII(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		for r := rune(0); r < 128; r++ {
+			escapeRune(r)
+		}
+	}
+}
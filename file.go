@@ -0,0 +1,68 @@
+package hadoopfiles
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"os"
+)
+
+// Describes a completed file for verifiable export manifests.
+type FileManifest struct {
+	Path   string
+	Rows   int64
+	Bytes  int64
+	SHA256 string // hex encoded
+}
+
+// A StreamWriter that writes rows to a file while hashing them, so a manifest
+// can be produced when the file is finalized without re-reading it.
+type FileWriter struct {
+	*StreamWriter
+	out *manifestWriter
+}
+
+// Hashes and counts everything written to a file. StreamWriter writes each
+// row with a single Write, so every Write is a row.
+type manifestWriter struct {
+	f     *os.File
+	h     hash.Hash
+	rows  int64
+	bytes int64
+}
+
+func (m *manifestWriter) Write(p []byte) (int, error) {
+	n, err := m.f.Write(p)
+	m.h.Write(p[:n])
+	m.bytes += int64(n)
+	if err == nil {
+		m.rows++
+	}
+	return n, err
+}
+
+// Creates a FileWriter with the default delimiters writing to a new file at
+// path, truncating it if it exists.
+func NewFileWriter(path string) (*FileWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	out := &manifestWriter{f: f, h: sha256.New()}
+	return &FileWriter{StreamWriter: NewStreamWriter(out), out: out}, nil
+}
+
+// Closes the file and returns its manifest. Rows in progress are discarded
+// and no more rows may be written.
+func (w *FileWriter) Finalize() (FileManifest, error) {
+	w.Reset()
+	if err := w.out.f.Close(); err != nil {
+		return FileManifest{}, err
+	}
+	return FileManifest{
+		Path:   w.out.f.Name(),
+		Rows:   w.out.rows,
+		Bytes:  w.out.bytes,
+		SHA256: hex.EncodeToString(w.out.h.Sum(nil)),
+	}, nil
+}
@@ -0,0 +1,46 @@
+package hadoopfiles
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileWriterFinalize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rows")
+	w, err := NewFileWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		w.WriteInt(i)
+		w.WriteString("a\x01b")
+		if err := w.EndRow(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.WriteString("discarded")
+
+	m, err := w.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	expected := FileManifest{Path: path, Rows: 3, Bytes: int64(len(data)), SHA256: hex.EncodeToString(sum[:])}
+	if m != expected {
+		t.Errorf("Expected: %+v !=\nActual:  %+v", expected, m)
+	}
+	if len(data) != 3*len("0\x01a\\x01b\x01\n") {
+		t.Errorf("Unexpected file contents: %q", data)
+	}
+
+	if err := w.EndRow(); err == nil {
+		t.Error("Expected an error writing after Finalize")
+	}
+}
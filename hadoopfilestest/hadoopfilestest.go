@@ -0,0 +1,56 @@
+// Helpers for testing that values survive being written by a RowWriter and
+// read back by a RowReader, such as to verify that a delimiter and escaping
+// configuration is lossless for a table's data.
+package hadoopfilestest
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/schmichael/hadoopfiles"
+)
+
+// Writes values as a row with w, decodes it with r into values of the same
+// types, and returns an error describing the first column that didn't decode
+// to an equal value.
+func Check(w *hadoopfiles.RowWriter, r *hadoopfiles.RowReader, values ...interface{}) error {
+	fields := make([]reflect.StructField, len(values))
+	for i, v := range values {
+		if v == nil {
+			return fmt.Errorf("Column %d: untyped nil has no type to decode", i)
+		}
+		fields[i] = reflect.StructField{Name: fmt.Sprintf("C%d", i), Type: reflect.TypeOf(v)}
+	}
+
+	for i, v := range values {
+		if !w.WriteField(v) {
+			w.Reset()
+			return fmt.Errorf("Column %d: unsupported type %T", i, v)
+		}
+	}
+	if err := w.Err(); err != nil {
+		w.Reset()
+		return err
+	}
+	row := w.Row()
+
+	dst := reflect.New(reflect.StructOf(fields))
+	if err := r.DecodeRow(row, dst.Interface()); err != nil {
+		return fmt.Errorf("Decoding %q: %v", row, err)
+	}
+	for i, v := range values {
+		if got := dst.Elem().Field(i).Interface(); !reflect.DeepEqual(got, v) {
+			return fmt.Errorf("Column %d: wrote %#v but read %#v from %q", i, v, got, row)
+		}
+	}
+	return nil
+}
+
+// Fails t unless values round trip through w and r as Check describes.
+func RoundTrip(t testing.TB, w *hadoopfiles.RowWriter, r *hadoopfiles.RowReader, values ...interface{}) {
+	t.Helper()
+	if err := Check(w, r, values...); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,34 @@
+package hadoopfilestest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/schmichael/hadoopfiles"
+)
+
+func TestRoundTrip(t *testing.T) {
+	w, r := hadoopfiles.NewRowWriter(), hadoopfiles.NewRowReader()
+	RoundTrip(t, w, r,
+		"a\x01b\nc\\",
+		42,
+		-1.5,
+		true,
+		[]string{"x\x02", "y"},
+		map[string]int{"k\x03": 1},
+		time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC),
+		hadoopfiles.Nullable[int]{Value: 7, Valid: true},
+	)
+
+	// Unescaped delimiters in values split fields.
+	if err := w.SetEscaping(false); err != nil {
+		t.Fatal(err)
+	}
+	r.SetEscaping(false)
+	if err := Check(w, r, "a\x01b", "c"); err == nil {
+		t.Error("Expected an unescaped delimiter to fail the round trip")
+	}
+	if err := Check(w, r, nil); err == nil {
+		t.Error("Expected an error for an untyped nil")
+	}
+}
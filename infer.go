@@ -0,0 +1,175 @@
+package hadoopfiles
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reads up to maxRows of the remaining rows, or all of them if maxRows < 1,
+// and returns a best-guess Schema for them. Columns become BIGINT, DOUBLE,
+// BOOLEAN, TIMESTAMP, DATE, or STRING if every non-NULL value parses as the
+// type, preferring the narrowest, and values with unescaped item or map key
+// delimiters become ARRAYs and MAPs of inferred element types. Columns are
+// named col0, col1, and so on, and only NULLs are inferred as STRING.
+// Partition columns set by SetPartitionPath aren't included, and the NULL
+// token and delimiters are the Scanner's.
+func (sc *Scanner) InferSchema(maxRows int) (Schema, error) {
+	var cols []*inferredType
+	for n := 0; maxRows < 1 || n < maxRows; n++ {
+		row, ok := sc.nextRow()
+		if !ok {
+			break
+		}
+		fields, err := sc.splitRow(row)
+		if err != nil {
+			return Schema{}, fmt.Errorf("Row %d: %v", n, err)
+		}
+		// Partition columns are in the path rather than the file
+		fields = fields[:len(fields)-len(sc.partition)]
+		for i, raw := range fields {
+			t, err := sc.inferType(raw, 0)
+			if err != nil {
+				return Schema{}, fmt.Errorf("Row %d column %d: %v", n, i, err)
+			}
+			if i == len(cols) {
+				cols = append(cols, nil)
+			}
+			cols[i] = mergeTypes(cols[i], t)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return Schema{}, err
+	}
+
+	schema := Schema{
+		Delimiters: Delimiters{Field: sc.fieldDelimiter, Item: sc.itemDelimiter, MapKey: sc.mapKeyDelimiter, Line: sc.lineEnding},
+		NullString: sc.nullString,
+		NoEscaping: sc.noEscape,
+	}
+	for i, t := range cols {
+		schema.Columns = append(schema.Columns, Column{Name: fmt.Sprintf("col%d", i), Type: t.hiveType()})
+	}
+	return schema, nil
+}
+
+// A type inferred from values: a primitive type, or an ARRAY or MAP.
+type inferredType struct {
+	kind HiveType
+	key  *inferredType // MAP key
+	elem *inferredType // ARRAY element or MAP value
+}
+
+// Returns the Hive type, using STRING where nothing was inferred.
+func (t *inferredType) hiveType() HiveType {
+	switch {
+	case t == nil:
+		return HiveString
+	case t.kind == "ARRAY":
+		return "ARRAY<" + t.elem.hiveType() + ">"
+	case t.kind == "MAP":
+		return "MAP<" + t.key.hiveType() + "," + t.elem.hiveType() + ">"
+	}
+	return t.kind
+}
+
+// Infers the type of raw, a value at a nesting level. Returns nil for NULL.
+func (r *RowReader) inferType(raw []byte, level int) (*inferredType, error) {
+	if len(raw) == 0 || string(raw) == r.nullString {
+		return nil, nil
+	}
+	if level+2 < len(r.levels) {
+		items := r.splitItems(raw, r.levels[level+1])
+		isMap := true
+		for _, item := range items {
+			isMap = isMap && r.index(item, r.levels[level+2]) >= 0
+		}
+		if isMap {
+			t := &inferredType{kind: "MAP"}
+			for _, item := range items {
+				i := r.index(item, r.levels[level+2])
+				k, err := r.inferType(item[:i], level+2)
+				if err != nil {
+					return nil, err
+				}
+				v, err := r.inferType(item[i+1:], level+2)
+				if err != nil {
+					return nil, err
+				}
+				t.key, t.elem = mergeTypes(t.key, k), mergeTypes(t.elem, v)
+			}
+			return t, nil
+		}
+		if len(items) > 1 {
+			t := &inferredType{kind: "ARRAY"}
+			for _, item := range items {
+				e, err := r.inferType(item, level+1)
+				if err != nil {
+					return nil, err
+				}
+				t.elem = mergeTypes(t.elem, e)
+			}
+			return t, nil
+		}
+	}
+
+	s, err := r.unescape(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &inferredType{kind: inferScalar(s)}, nil
+}
+
+// Returns the narrowest primitive type s parses as.
+func inferScalar(s string) HiveType {
+	if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return HiveBigInt
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return HiveDouble
+	}
+	if strings.EqualFold(s, "true") || strings.EqualFold(s, "false") {
+		return HiveBoolean
+	}
+	if _, err := time.Parse(DateFormat, s); err == nil {
+		return HiveDate
+	}
+	if _, err := time.Parse(TimestampFormat, s); err == nil {
+		return HiveTimestamp
+	}
+	return HiveString
+}
+
+// Primitive types which merge into a wider type rather than STRING.
+var widenedTypes = map[[2]HiveType]HiveType{
+	{HiveBigInt, HiveDouble}:  HiveDouble,
+	{HiveDouble, HiveBigInt}:  HiveDouble,
+	{HiveDate, HiveTimestamp}: HiveTimestamp,
+	{HiveTimestamp, HiveDate}: HiveTimestamp,
+}
+
+// Returns the narrowest type both a and b's values fit. A collection and a
+// primitive merge into a collection, as a collection of one element has no
+// delimiters, and otherwise different types merge into STRING.
+func mergeTypes(a, b *inferredType) *inferredType {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	case a.kind == b.kind:
+		if a.kind == "ARRAY" || a.kind == "MAP" {
+			return &inferredType{kind: a.kind, key: mergeTypes(a.key, b.key), elem: mergeTypes(a.elem, b.elem)}
+		}
+		return a
+	case a.kind == "ARRAY" && b.kind != "MAP":
+		return &inferredType{kind: "ARRAY", elem: mergeTypes(a.elem, b)}
+	case b.kind == "ARRAY" && a.kind != "MAP":
+		return &inferredType{kind: "ARRAY", elem: mergeTypes(a, b.elem)}
+	}
+	if t, ok := widenedTypes[[2]HiveType{a.kind, b.kind}]; ok {
+		return &inferredType{kind: t}
+	}
+	return &inferredType{kind: HiveString}
+}
@@ -0,0 +1,66 @@
+package hadoopfiles
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInferSchema(t *testing.T) {
+	w := NewRowWriter()
+	var data bytes.Buffer
+	ts := time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i, row := range [][]interface{}{
+		{1, 1, "TRUE", ts, []string{"a", "b"}, map[string]int{"x": 1}, nil, "2014-01-02"},
+		{2, 1.5, "false", ts, []string{"c"}, map[string]int{"y": 2, "z": 3}, nil, "a\x02b"},
+	} {
+		for _, f := range row {
+			if !w.WriteField(f) {
+				t.Fatalf("Row %d: unsupported field %T", i, f)
+			}
+		}
+		data.Write(w.Row())
+	}
+	data.Write([]byte("3\x01\n"))
+
+	schema, err := NewScanner(&data).InferSchema(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Column{
+		{"col0", HiveBigInt},
+		{"col1", HiveDouble},
+		{"col2", HiveBoolean},
+		{"col3", HiveTimestamp},
+		{"col4", "ARRAY<STRING>"},
+		{"col5", "MAP<STRING,BIGINT>"},
+		{"col6", HiveString},
+		{"col7", HiveString},
+	}
+	if !reflect.DeepEqual(schema.Columns, expected) {
+		t.Errorf("Expected: %v !=\nActual:   %v", expected, schema.Columns)
+	}
+	if schema.Delimiters != DefaultDelimiters {
+		t.Errorf("Expected the default delimiters but found: %+v", schema.Delimiters)
+	}
+}
+
+func TestInferSchemaNullAndPartitions(t *testing.T) {
+	sc := NewScanner(bytes.NewBufferString("1\x01NULL\n2\x01x\n"))
+	sc.SetNullString("NULL")
+	if err := sc.SetPartitionPath("dt=2014-01-02/hr=3"); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := sc.InferSchema(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Column{{"col0", HiveBigInt}, {"col1", HiveString}}
+	if !reflect.DeepEqual(schema.Columns, expected) {
+		t.Errorf("Expected: %v !=\nActual:   %v", expected, schema.Columns)
+	}
+	if schema.NullString != "NULL" {
+		t.Errorf("Expected the Scanner's NULL token but found: %q", schema.NullString)
+	}
+}
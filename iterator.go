@@ -0,0 +1,52 @@
+package hadoopfiles
+
+// Iterates over the rows in a block of concatenated rows, such as a whole
+// file in memory, splitting and unescaping one row at a time.
+type RowIterator struct {
+	data           []byte
+	fieldDelimiter byte
+	lineEnding     byte
+	fields         []string
+	err            error
+}
+
+// Creates a RowIterator over data using the given field delimiter and line
+// ending.
+func NewRowIterator(data []byte, field, line byte) *RowIterator {
+	return &RowIterator{data: data, fieldDelimiter: field, lineEnding: line}
+}
+
+// Advances to the next row, returning false when there are no more rows or an
+// error occurred.
+func (it *RowIterator) Next() bool {
+	if it.err != nil || len(it.data) == 0 {
+		return false
+	}
+	var row []byte
+	if i := indexUnescaped(it.data, it.lineEnding); i < 0 {
+		// Final row without a line ending
+		row, it.data = it.data, nil
+	} else {
+		row, it.data = it.data[:i], it.data[i+1:]
+	}
+
+	raw := splitFields(row, it.fieldDelimiter)
+	it.fields = make([]string, len(raw))
+	for i, f := range raw {
+		if it.fields[i], it.err = unescape(f); it.err != nil {
+			it.fields = nil
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the unescaped fields of the current row.
+func (it *RowIterator) Fields() []string {
+	return it.fields
+}
+
+// Returns the error, if any, that stopped iteration.
+func (it *RowIterator) Err() error {
+	return it.err
+}
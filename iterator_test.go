@@ -0,0 +1,41 @@
+package hadoopfiles
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRowIterator(t *testing.T) {
+	f := NewRowWriter()
+	rows := [][]string{
+		{"a", "b\x01c", "d\\"},
+		{"", "line\nbreak", "ünï​code"},
+		{"last"},
+	}
+	var data []byte
+	for _, row := range rows {
+		data = append(data, f.WriteStringRow(row)...)
+	}
+
+	it := NewRowIterator(data, DefaultFieldDelimiter, DefaultLineEnding)
+	i := 0
+	for ; it.Next(); i++ {
+		if !reflect.DeepEqual(it.Fields(), rows[i]) {
+			t.Errorf("Row %d expected: %q !=\nActual: %q", i, rows[i], it.Fields())
+		}
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if i != len(rows) {
+		t.Fatalf("Expected %d rows but found %d", len(rows), i)
+	}
+
+	it = NewRowIterator([]byte("ok\x01\nbad\\x0\x01\n"), DefaultFieldDelimiter, DefaultLineEnding)
+	if !it.Next() || it.Fields()[0] != "ok" {
+		t.Fatalf("Expected first row to parse: %q %v", it.Fields(), it.Err())
+	}
+	if it.Next() || it.Err() == nil {
+		t.Fatal("Expected an error on a malformed escape")
+	}
+}
@@ -0,0 +1,93 @@
+package hadoopfiles
+
+import (
+	"fmt"
+	"io"
+)
+
+// Reads rows from an io.Reader like Scanner, but only finds the boundaries of
+// each row's fields when scanning. Fields are unescaped when accessed with
+// Field, so untouched columns of wide tables cost little. Configure
+// delimiters and escaping with the embedded RowReader's methods before the
+// first call to Scan.
+type LazyScanner struct {
+	*RowReader
+	sc     *Scanner
+	fields [][]byte // escaped fields of the current row
+}
+
+// Creates a LazyScanner with the default delimiters reading from r.
+func NewLazyScanner(r io.Reader) *LazyScanner {
+	sc := NewScanner(r)
+	return &LazyScanner{RowReader: sc.RowReader, sc: sc}
+}
+
+// Sets the maximum size of a row, as Scanner.SetMaxRowSize does.
+func (l *LazyScanner) SetMaxRowSize(n int) {
+	l.sc.SetMaxRowSize(n)
+}
+
+// Sets how rows that can't be split, such as rows rejected by
+// SetExpectedFields, are handled, as Scanner.SetBadRowPolicy does.
+func (l *LazyScanner) SetBadRowPolicy(p BadRowPolicy) {
+	l.sc.SetBadRowPolicy(p)
+}
+
+// Returns the number of rows skipped or replaced with NULLs by the
+// BadRowPolicy.
+func (l *LazyScanner) BadRows() int {
+	return l.sc.BadRows()
+}
+
+// Advances to the next row, returning false when there are no more rows or an
+// error occurred.
+func (l *LazyScanner) Scan() bool {
+	for {
+		row, ok := l.sc.nextRow()
+		if !ok {
+			l.fields = nil
+			return false
+		}
+		fields, err := l.splitRow(row)
+		if err == nil {
+			l.fields = fields
+			return true
+		}
+		if !l.sc.badRow() {
+			l.fields, l.sc.err = nil, err
+			return false
+		}
+		if l.sc.badRowPolicy == ReplaceWithNulls {
+			l.fields = make([][]byte, l.rowWidth(row))
+			return true
+		}
+	}
+}
+
+// Returns the number of fields in the current row.
+func (l *LazyScanner) NumFields() int {
+	return len(l.fields)
+}
+
+// Returns field i of the current row, unescaped.
+func (l *LazyScanner) Field(i int) (string, error) {
+	if i < 0 || i >= len(l.fields) {
+		return "", fmt.Errorf("Field %d out of range for a row of %d fields", i, len(l.fields))
+	}
+	return l.unescape(l.fields[i])
+}
+
+// Returns field i of the current row as written, without unescaping it, or
+// nil if the row has no field i. The bytes are only valid until the next
+// call to Scan.
+func (l *LazyScanner) RawField(i int) []byte {
+	if i < 0 || i >= len(l.fields) {
+		return nil
+	}
+	return l.fields[i]
+}
+
+// Returns the error, if any, that stopped scanning.
+func (l *LazyScanner) Err() error {
+	return l.sc.Err()
+}
@@ -0,0 +1,93 @@
+package hadoopfiles
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestLazyScanner(t *testing.T) {
+	w := NewRowWriter()
+	var data bytes.Buffer
+	data.Write(w.WriteStringRow([]string{"a\x01b", "", "c\nd"}))
+	data.Write(w.WriteStringRow([]string{"e"}))
+
+	sc := NewLazyScanner(&data)
+	if !sc.Scan() {
+		t.Fatalf("Expected a row: %v", sc.Err())
+	}
+	if n := sc.NumFields(); n != 3 {
+		t.Fatalf("Expected 3 fields but found %d", n)
+	}
+	for i, expected := range []string{"a\x01b", "", "c\nd"} {
+		f, err := sc.Field(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f != expected {
+			t.Errorf("Field %d expected: %q != %q", i, expected, f)
+		}
+	}
+	if raw := string(sc.RawField(0)); raw != `a\x01b` {
+		t.Errorf("Expected the raw field to be escaped but found: %q", raw)
+	}
+	if _, err := sc.Field(3); err == nil {
+		t.Error("Expected an error for a field out of range")
+	}
+
+	if !sc.Scan() {
+		t.Fatalf("Expected a second row: %v", sc.Err())
+	}
+	if f, _ := sc.Field(0); f != "e" || sc.NumFields() != 1 {
+		t.Errorf("Expected a single field \"e\" but found %d fields: %q", sc.NumFields(), f)
+	}
+	if sc.Scan() {
+		t.Error("Expected no more rows")
+	}
+	if err := sc.Err(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLazyScannerFieldCount(t *testing.T) {
+	input := "a\x01b\x01c\nd\ne\x01f\x01g\x01h\ni\x01j\x01k\n"
+	tests := []struct {
+		fields   FieldCountPolicy
+		bad      BadRowPolicy
+		expected [][]string
+		badRows  int
+		err      bool
+	}{
+		{FieldCountError, ErrorOnBadRow, [][]string{{"a", "b", "c"}}, 0, true},
+		{FieldCountError, SkipBadRow, [][]string{{"a", "b", "c"}, {"i", "j", "k"}}, 2, false},
+		{FieldCountPad, SkipBadRow, [][]string{{"a", "b", "c"}, {"d", "", ""}, {"i", "j", "k"}}, 1, false},
+		{FieldCountTruncate, SkipBadRow, [][]string{{"a", "b", "c"}, {"e", "f", "g"}, {"i", "j", "k"}}, 1, false},
+		{FieldCountError, ReplaceWithNulls, [][]string{{"a", "b", "c"}, {"", "", ""}, {"", "", ""}, {"i", "j", "k"}}, 2, false},
+	}
+	for _, test := range tests {
+		sc := NewLazyScanner(bytes.NewBufferString(input))
+		sc.SetExpectedFields(3, test.fields)
+		sc.SetBadRowPolicy(test.bad)
+		var rows [][]string
+		for sc.Scan() {
+			var row []string
+			for i := 0; i < sc.NumFields(); i++ {
+				f, err := sc.Field(i)
+				if err != nil {
+					t.Fatal(err)
+				}
+				row = append(row, f)
+			}
+			rows = append(rows, row)
+		}
+		if !reflect.DeepEqual(rows, test.expected) {
+			t.Errorf("Policies %d/%d expected: %q !=\nActual:  %q", test.fields, test.bad, test.expected, rows)
+		}
+		if n := sc.BadRows(); n != test.badRows {
+			t.Errorf("Policies %d/%d expected %d bad rows but found %d", test.fields, test.bad, test.badRows, n)
+		}
+		if err := sc.Err(); (err != nil) != test.err {
+			t.Errorf("Policies %d/%d unexpected error: %v", test.fields, test.bad, err)
+		}
+	}
+}
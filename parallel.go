@@ -0,0 +1,184 @@
+package hadoopfiles
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"iter"
+	"reflect"
+	"runtime"
+	"sync"
+)
+
+// The size of the chunks input is split into for parallel decoding. Each
+// chunk is extended to the end of the row it would otherwise split.
+var parallelChunkSize = 1 << 20
+
+// Returns an iterator over the fields of rows read from r and parsed by rr,
+// as ReadRow does, on workers goroutines. Input is split into chunks of whole
+// rows which are parsed concurrently, but rows are yielded in their original
+// order. workers < 1 uses GOMAXPROCS. Rows that fail to parse yield an error
+// and iteration continues; a read error is yielded last.
+func ParallelRows(r io.Reader, rr *RowReader, workers int) iter.Seq2[[]string, error] {
+	return parallelDecode(r, rr, workers, rr.ReadRow)
+}
+
+// Returns an iterator over rows read from r and decoded by rr into values of
+// the struct type T, as DecodeRow does, on workers goroutines, like
+// ParallelRows. An invalid T is yielded as a single error.
+func ParallelDecode[T any](r io.Reader, rr *RowReader, workers int) iter.Seq2[T, error] {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	var fields []fieldDecoder
+	err := fmt.Errorf("Decoder type must be a struct: %v", t)
+	if t.Kind() == reflect.Struct {
+		fields, err = fieldDecoders(t)
+	}
+	if err != nil {
+		return func(yield func(T, error) bool) {
+			var zero T
+			yield(zero, err)
+		}
+	}
+	return parallelDecode(r, rr, workers, func(row []byte) (T, error) {
+		var v T
+		if err := rr.decodeStruct(row, reflect.ValueOf(&v).Elem(), fields); err != nil {
+			var zero T
+			return zero, err
+		}
+		return v, nil
+	})
+}
+
+// A decoded row or the error decoding it.
+type decodeResult[R any] struct {
+	v   R
+	err error
+}
+
+// Reads chunks of rows from r and decodes each row with decode on workers
+// goroutines, yielding the results in order.
+func parallelDecode[R any](r io.Reader, rr *RowReader, workers int, decode func(row []byte) (R, error)) iter.Seq2[R, error] {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	return func(yield func(R, error) bool) {
+		type job struct {
+			chunk []byte
+			out   chan []decodeResult[R]
+		}
+		// Stop the goroutines, and so reading r, before returning.
+		done := make(chan struct{})
+		var wg sync.WaitGroup
+		defer func() {
+			close(done)
+			wg.Wait()
+		}()
+		jobs := make(chan job)
+		// Bounds the chunks in flight; results are read in this order.
+		order := make(chan chan []decodeResult[R], 2*workers)
+
+		var readErr error
+		wg.Add(1 + workers)
+		go func() {
+			defer wg.Done()
+			defer close(order)
+			defer close(jobs)
+			readErr = rr.readChunks(r, func(chunk []byte) bool {
+				out := make(chan []decodeResult[R], 1)
+				select {
+				case order <- out:
+				case <-done:
+					return false
+				}
+				select {
+				case jobs <- job{chunk, out}:
+					return true
+				case <-done:
+					return false
+				}
+			})
+		}()
+		for i := 0; i < workers; i++ {
+			go func() {
+				defer wg.Done()
+				for j := range jobs {
+					j.out <- decodeChunk(rr, j.chunk, decode)
+				}
+			}()
+		}
+
+		for out := range order {
+			for _, res := range <-out {
+				if !yield(res.v, res.err) {
+					return
+				}
+			}
+		}
+		if readErr != nil {
+			var zero R
+			yield(zero, readErr)
+		}
+	}
+}
+
+// Reads r in chunks ending with a line ending, except the last, and calls
+// emit with each until it returns false.
+func (rr *RowReader) readChunks(r io.Reader, emit func(chunk []byte) bool) error {
+	var carry []byte // the row split by the end of the previous chunk
+	for {
+		chunk := make([]byte, max(parallelChunkSize, 2*len(carry)))
+		copy(chunk, carry)
+		n, err := io.ReadFull(r, chunk[len(carry):])
+		chunk = chunk[:len(carry)+n]
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			if len(chunk) > 0 {
+				emit(chunk)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		end := rr.lastLineEnding(chunk)
+		if end < 0 {
+			carry = chunk
+			continue
+		}
+		carry = chunk[end+1:]
+		if !emit(chunk[:end+1]) {
+			return nil
+		}
+	}
+}
+
+// Returns the index of the last unescaped line ending in b, or -1.
+func (rr *RowReader) lastLineEnding(b []byte) int {
+	if rr.noEscape {
+		return bytes.LastIndexByte(b, rr.lineEnding)
+	}
+	last := -1
+	for {
+		i := indexUnescaped(b[last+1:], rr.lineEnding)
+		if i < 0 {
+			return last
+		}
+		last += i + 1
+	}
+}
+
+// Decodes each row of a chunk with decode.
+func decodeChunk[R any](rr *RowReader, chunk []byte, decode func(row []byte) (R, error)) []decodeResult[R] {
+	var results []decodeResult[R]
+	for len(chunk) > 0 {
+		i := rr.index(chunk, rr.lineEnding)
+		row := chunk
+		if i < 0 {
+			chunk = nil
+		} else {
+			row, chunk = chunk[:i], chunk[i+1:]
+		}
+		v, err := decode(row)
+		results = append(results, decodeResult[R]{v, err})
+	}
+	return results
+}
@@ -0,0 +1,89 @@
+package hadoopfiles
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParallelRows(t *testing.T) {
+	defer func(size int) { parallelChunkSize = size }(parallelChunkSize)
+	parallelChunkSize = 16
+
+	w := NewRowWriter()
+	var data bytes.Buffer
+	var expected [][]string
+	for i := 0; i < 200; i++ {
+		row := []string{fmt.Sprint(i), strings.Repeat("x\n", i%7)}
+		expected = append(expected, row)
+		data.Write(w.WriteStringRow(row))
+	}
+	data.Write([]byte("bad\\x\x01\n"))
+
+	var rows [][]string
+	var errs int
+	for fields, err := range ParallelRows(bytes.NewReader(data.Bytes()), NewRowReader(), 4) {
+		if err != nil {
+			errs++
+			continue
+		}
+		rows = append(rows, fields)
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Rows out of order or corrupted:\n%q", rows)
+	}
+	if errs != 1 {
+		t.Errorf("Expected 1 error but found %d", errs)
+	}
+
+	for range ParallelRows(bytes.NewReader(data.Bytes()), NewRowReader(), 2) {
+		break // stopping early must not block
+	}
+
+	readErr := errors.New("boom")
+	var last error
+	for _, err := range ParallelRows(errReader{readErr}, NewRowReader(), 2) {
+		last = err
+	}
+	if !errors.Is(last, readErr) {
+		t.Errorf("Expected the read error but found: %v", last)
+	}
+}
+
+func TestParallelDecode(t *testing.T) {
+	defer func(size int) { parallelChunkSize = size }(parallelChunkSize)
+	parallelChunkSize = 10
+
+	type row struct {
+		N    int
+		Name string
+	}
+	var data bytes.Buffer
+	var expected []row
+	w := NewRowWriter()
+	for i := 0; i < 100; i++ {
+		expected = append(expected, row{i, fmt.Sprint("r", i)})
+		w.WriteInt(i)
+		w.WriteString(fmt.Sprint("r", i))
+		data.Write(w.Row())
+	}
+	var rows []row
+	for r, err := range ParallelDecode[row](&data, NewRowReader(), 0) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, r)
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected: %v !=\nActual:   %v", expected, rows)
+	}
+
+	for _, err := range ParallelDecode[int](&data, NewRowReader(), 1) {
+		if err == nil {
+			t.Error("Expected an error for a non-struct type")
+		}
+	}
+}
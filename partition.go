@@ -0,0 +1,77 @@
+package hadoopfiles
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// The directory name value Hive uses for a NULL partition value.
+const DefaultPartitionName = "__HIVE_DEFAULT_PARTITION__"
+
+// A partition column and its value as stored in a directory name.
+type PartitionValue struct {
+	Name  string
+	Value string
+	Null  bool // the value is DefaultPartitionName
+}
+
+// Parses the partition columns from the key=value segments of a path, such
+// as dt=2024-01-01/country=US/000000_0, in order. Other segments are ignored.
+// Names and values are unescaped from Hive's %XX escaping.
+func ParsePartitionPath(path string) ([]PartitionValue, error) {
+	var values []PartitionValue
+	for _, seg := range strings.Split(strings.ReplaceAll(path, "\\", "/"), "/") {
+		k, v, ok := strings.Cut(seg, "=")
+		if !ok {
+			continue
+		}
+		name, err := url.PathUnescape(k)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid partition segment %q: %v", seg, err)
+		}
+		value, err := url.PathUnescape(v)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid partition segment %q: %v", seg, err)
+		}
+		values = append(values, PartitionValue{Name: name, Value: value, Null: v == DefaultPartitionName})
+	}
+	return values, nil
+}
+
+// Appends the partition values in path, as parsed by ParsePartitionPath, to
+// every row read as virtual trailing columns, as Hive does for partitioned
+// tables. NULL partitions are read as the null token. An empty path removes
+// the columns. Call it after setting delimiters, escaping, and the null
+// token.
+func (r *RowReader) SetPartitionPath(path string) error {
+	values, err := ParsePartitionPath(path)
+	if err != nil {
+		return err
+	}
+	r.partition = nil
+	for _, v := range values {
+		r.partition = append(r.partition, r.escapePartition(v))
+	}
+	return nil
+}
+
+// Returns a partition value as it would appear in a row, escaped so it's read
+// back unchanged.
+func (r *RowReader) escapePartition(v PartitionValue) []byte {
+	if v.Null {
+		return []byte(r.nullString)
+	}
+	if r.noEscape {
+		return []byte(v.Value)
+	}
+	var b []byte
+	for i := 0; i < len(v.Value); i++ {
+		c := v.Value[i]
+		if c == '\\' || c == r.lineEnding || strings.IndexByte(string(r.levels), c) >= 0 {
+			b = append(b, '\\')
+		}
+		b = append(b, c)
+	}
+	return b
+}
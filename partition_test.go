@@ -0,0 +1,61 @@
+package hadoopfiles
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePartitionPath(t *testing.T) {
+	values, err := ParsePartitionPath("/warehouse/t/dt=2024-01-01/country=US%2FCA/n=" + DefaultPartitionName + "/000000_0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []PartitionValue{
+		{Name: "dt", Value: "2024-01-01"},
+		{Name: "country", Value: "US/CA"},
+		{Name: "n", Value: DefaultPartitionName, Null: true},
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected: %+v !=\nActual:   %+v", expected, values)
+	}
+	if _, err := ParsePartitionPath("dt=%zz/x"); err == nil {
+		t.Error("Expected an error for an invalid escape")
+	}
+}
+
+func TestSetPartitionPath(t *testing.T) {
+	sc := NewScanner(strings.NewReader("a\x01\nb\x01\n"))
+	if err := sc.SetPartitionPath("t/dt=2024-01-01/k=x%01y/n=" + DefaultPartitionName + "/part-0"); err != nil {
+		t.Fatal(err)
+	}
+	var rows [][]string
+	for sc.Scan() {
+		rows = append(rows, sc.Fields())
+	}
+	expected := [][]string{{"a", "2024-01-01", "x\x01y", ""}, {"b", "2024-01-01", "x\x01y", ""}}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected: %q !=\nActual:   %q", expected, rows)
+	}
+
+	var dst struct {
+		Name string
+		Dt   string
+		K    string
+		N    *int
+	}
+	r := NewRowReader()
+	r.SetNullString(`\N`)
+	if err := r.SetPartitionPath("dt=2024-01-01/k=x%01y/n=" + DefaultPartitionName); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DecodeRow([]byte("c\x01"), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Name != "c" || dst.Dt != "2024-01-01" || dst.K != "x\x01y" || dst.N != nil {
+		t.Errorf("Unexpected decoded struct: %+v", dst)
+	}
+	if fields, _ := sc.ReadColumns([]byte("c\x01d\x01"), []int{2}); !reflect.DeepEqual(fields, []string{"2024-01-01"}) {
+		t.Errorf("Expected the partition column but found: %q", fields)
+	}
+}
@@ -0,0 +1,186 @@
+//go:build protobuf
+
+package hadoopfiles
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Support for messages generated by protoc-gen-go, enabled with the protobuf
+// build tag and tested with:
+//
+//	go test -tags protobuf
+//
+// Messages are read through the protobuf struct tags of the generated code
+// rather than google.golang.org/protobuf, so the tag adds no dependency.
+
+func init() {
+	protoWriter = writeProto
+}
+
+// Implemented by every message generated by protoc-gen-go.
+type protoMessage interface {
+	ProtoMessage()
+}
+
+var protoMessageType = reflect.TypeOf((*protoMessage)(nil)).Elem()
+
+// A field of a generated message.
+type protoField struct {
+	index  int // of the Go struct field
+	number int // protobuf field number
+}
+
+// Writes a protobuf message as one column per field in field number order,
+// returning false if v isn't a message. Repeated fields become ARRAYs, maps
+// become MAPs, and nested messages become STRUCTs using the delimiters one
+// level deeper. Unset messages and optional scalars are NULL, as are all the
+// columns of a nil message. Fields that can't be written, such as oneofs,
+// record an error.
+func writeProto(w *RowWriter, v interface{}) bool {
+	if !isProtoMessage(reflect.TypeOf(v)) {
+		return false
+	}
+	rv := reflect.ValueOf(v)
+	t := rv.Type().Elem()
+	fields, err := protoFields(t)
+	if err != nil {
+		w.setErr(err)
+		return true
+	}
+	for _, f := range fields {
+		w.beginField()
+		if rv.IsNil() {
+			w.writeNullToken(0)
+		} else if start := w.buf.Len(); !w.writeProtoValue(rv.Elem().Field(f.index), 0) {
+			w.buf.Truncate(start)
+			w.setErr(fmt.Errorf("Unsupported protobuf field %s of type %v", t.Field(f.index).Name, t.Field(f.index).Type))
+		}
+		w.endField()
+	}
+	return true
+}
+
+// Returns whether t is a pointer to a generated message struct.
+func isProtoMessage(t reflect.Type) bool {
+	return t != nil && t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct && t.Implements(protoMessageType)
+}
+
+// Returns the fields of a generated message struct sorted by field number.
+// Returns an error for oneofs, which have no single column type.
+func protoFields(t reflect.Type) ([]protoField, error) {
+	var fields []protoField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if _, ok := f.Tag.Lookup("protobuf_oneof"); ok {
+			return nil, fmt.Errorf("Unsupported protobuf oneof field %s", f.Name)
+		}
+		tag, ok := f.Tag.Lookup("protobuf")
+		if !ok {
+			// Internal state of the generated code
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("Invalid protobuf tag on field %s: %q", f.Name, tag)
+		}
+		n, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid protobuf tag on field %s: %q", f.Name, tag)
+		}
+		fields = append(fields, protoField{index: i, number: n})
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].number < fields[j].number })
+	return fields, nil
+}
+
+// Writes a field value of a generated message at a nesting level without a
+// trailing delimiter.
+func (w *RowWriter) writeProtoValue(v reflect.Value, level int) bool {
+	switch {
+	case isProtoMessage(v.Type()):
+		if v.IsNil() {
+			w.writeNullToken(level)
+			return true
+		}
+		delim, ok := w.delimiter(level + 1)
+		if !ok {
+			return false
+		}
+		fields, err := protoFields(v.Type().Elem())
+		if err != nil {
+			w.setErr(err)
+			return false
+		}
+		for i, f := range fields {
+			if i > 0 {
+				w.buf.WriteByte(delim)
+			}
+			if !w.writeProtoValue(v.Elem().Field(f.index), level+1) {
+				return false
+			}
+		}
+		return true
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8:
+		delim, ok := w.delimiter(level + 1)
+		if !ok {
+			return false
+		}
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				w.buf.WriteByte(delim)
+			}
+			if !w.writeProtoValue(v.Index(i), level+1) {
+				return false
+			}
+		}
+		return true
+	case v.Kind() == reflect.Map:
+		itemDelim, ok := w.delimiter(level + 1)
+		if !ok {
+			return false
+		}
+		keyDelim, ok := w.delimiter(level + 2)
+		if !ok {
+			return false
+		}
+		keys := v.MapKeys()
+		if w.sortMapKeys {
+			sort.Slice(keys, func(i, j int) bool { return lessKey(keys[i], keys[j]) })
+		}
+		for i, k := range keys {
+			if i > 0 {
+				w.buf.WriteByte(itemDelim)
+			}
+			if !w.writeValue(k, level+2) {
+				return false
+			}
+			w.buf.WriteByte(keyDelim)
+			if !w.writeProtoValue(v.MapIndex(k), level+2) {
+				return false
+			}
+		}
+		return true
+	case v.Kind() == reflect.Ptr:
+		// Optional scalars
+		if v.IsNil() {
+			w.writeNullToken(level)
+			return true
+		}
+		return w.writeProtoValue(v.Elem(), level)
+	case v.Kind() == reflect.Int32 && v.Type().Implements(stringerType):
+		// Enums are written by name
+		w.writeString(v.Interface().(fmt.Stringer).String())
+		return true
+	case v.Kind() == reflect.Interface:
+		// Oneofs are rejected by protoFields
+		return false
+	}
+	return w.writeValue(v, level)
+}
+
+var stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
@@ -0,0 +1,107 @@
+//go:build protobuf
+
+package hadoopfiles
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Shaped like protoc-gen-go's output for:
+//
+//	message Event {
+//	  string name = 2;
+//	  int64 id = 1;
+//	  repeated string tags = 3;
+//	  Point point = 4;
+//	  Kind kind = 5;
+//	  optional int32 rank = 6;
+//	  message Point { int32 x = 1; int32 y = 2; }
+//	  enum Kind { UNKNOWN = 0; CLICK = 1; }
+//	}
+type testProtoEvent struct {
+	state         struct{}
+	sizeCache     int32
+	unknownFields []byte
+
+	Name  string          `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Id    int64           `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Tags  []string        `protobuf:"bytes,3,rep,name=tags,proto3" json:"tags,omitempty"`
+	Point *testProtoPoint `protobuf:"bytes,4,opt,name=point,proto3" json:"point,omitempty"`
+	Kind  testProtoKind   `protobuf:"varint,5,opt,name=kind,proto3,enum=test.Event_Kind" json:"kind,omitempty"`
+	Rank  *int32          `protobuf:"varint,6,opt,name=rank,proto3,oneof" json:"rank,omitempty"`
+}
+
+func (*testProtoEvent) ProtoMessage() {}
+
+type testProtoPoint struct {
+	state struct{}
+
+	X int32 `protobuf:"varint,1,opt,name=x,proto3" json:"x,omitempty"`
+	Y int32 `protobuf:"varint,2,opt,name=y,proto3" json:"y,omitempty"`
+}
+
+func (*testProtoPoint) ProtoMessage() {}
+
+type testProtoKind int32
+
+func (k testProtoKind) String() string {
+	if k == 1 {
+		return "CLICK"
+	}
+	return "UNKNOWN"
+}
+
+type testProtoOneof struct {
+	Value isTestProtoOneofValue `protobuf_oneof:"value"`
+}
+
+func (*testProtoOneof) ProtoMessage() {}
+
+type isTestProtoOneofValue interface{ isValue() }
+
+func TestWriteFieldProto(t *testing.T) {
+	f := NewRowWriter()
+	f.SetNullString(`\N`)
+	msg := &testProtoEvent{Id: 42, Name: "a\x01b", Tags: []string{"x", "y"}, Kind: 1}
+	if !f.WriteField(msg) {
+		t.Fatal("WriteField failed on a protobuf message")
+	}
+	f.WriteString("next")
+	if err := f.Err(); err != nil {
+		t.Fatal(err)
+	}
+	// Columns are in field number order and unset fields are NULL
+	expected := "42\x01a\\x01b\x01x\x02y\x01\\N\x01CLICK\x01\\N\x01next\x01\n"
+	if out := f.Row(); string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+
+	rank := int32(-3)
+	msg.Point = &testProtoPoint{X: 1, Y: -2}
+	msg.Rank = &rank
+	f.WriteField(msg)
+	expected = "42\x01a\\x01b\x01x\x02y\x011\x02-2\x01CLICK\x01-3\x01\n"
+	if out := f.Row(); string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+
+	f.WriteField((*testProtoEvent)(nil))
+	if out, expected := f.Row(), "\\N\x01\\N\x01\\N\x01\\N\x01\\N\x01\\N\x01\n"; string(out) != expected {
+		t.Errorf("Expected a NULL per column: %q !=\nActual:  %q", expected, out)
+	}
+
+	f.WriteField(&testProtoOneof{})
+	if f.Err() == nil {
+		t.Error("Expected an error for a oneof field")
+	}
+	f.Reset()
+
+	if _, err := f.FieldBytes(msg); err == nil {
+		t.Error("Expected FieldBytes to reject a message written as several fields")
+	}
+	var buf bytes.Buffer
+	if err := f.WriteFieldTo(&buf, msg); err == nil || buf.Len() != 0 {
+		t.Errorf("Expected WriteFieldTo to reject a message without writing: %v %q", err, buf.Bytes())
+	}
+}
@@ -0,0 +1,306 @@
+package hadoopfiles
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// Parses rows written by RowWriter, splitting them into fields and reversing
+// its escaping. Configure it with the same delimiters and escaping options as
+// the writer.
+type RowReader struct {
+	fieldDelimiter  byte
+	itemDelimiter   byte
+	mapKeyDelimiter byte
+	lineEnding      byte
+	levels          []byte // delimiters by nesting level, starting with field
+	noEscape        bool
+	nullString      string
+	fieldSeparator  []byte // multi-character field delimiter, if set
+
+	location         *time.Location // nil is UTC
+	timestampLayouts []string
+	partition        [][]byte // escaped partition values appended to rows
+	trimCR           bool
+	expectedFields   int // 0 accepts any number
+	fieldCountPolicy FieldCountPolicy
+}
+
+// What to do with a row that doesn't have the expected number of fields.
+type FieldCountPolicy int
+
+const (
+	FieldCountError    FieldCountPolicy = iota // reject the row (default)
+	FieldCountPad                              // pad short rows with NULLs, reject long rows
+	FieldCountTruncate                         // drop extra fields of long rows, reject short rows
+)
+
+// Creates a new RowReader with the default delimiters. Overwrite delimiters
+// with SetDelimiters.
+func NewRowReader() *RowReader {
+	r := &RowReader{}
+	err := r.SetDelimiters(
+		DefaultFieldDelimiter,
+		DefaultItemDelimiter,
+		DefaultMapKeyDelimiter,
+		DefaultLineEnding,
+	)
+	if err != nil {
+		panic("Default delimiters are invalid: " + err.Error())
+	}
+	return r
+}
+
+// Sets the delimiters of rows being read. The same restrictions as
+// RowWriter.SetDelimiters apply.
+func (r *RowReader) SetDelimiters(field, item, key, line byte) error {
+	if err := validateDelimiters(field, item, key, line, r.noEscape); err != nil {
+		return err
+	}
+	r.fieldDelimiter = field
+	r.itemDelimiter = item
+	r.mapKeyDelimiter = key
+	r.lineEnding = line
+	r.levels = delimiterLevels(field, item, key, line)
+	r.fieldSeparator = nil
+	return nil
+}
+
+// Sets a field delimiter of several characters, such as "||", as Hive's
+// MultiDelimitSerDe uses. Collections still use the single character item
+// and map key delimiters. No byte of sep may be another delimiter, or a
+// backslash when escaping is enabled. SetDelimiters replaces sep.
+func (r *RowReader) SetFieldSeparator(sep string) error {
+	if sep == "" {
+		return fmt.Errorf("Field separator must not be empty")
+	}
+	for i := 0; i < len(sep); i++ {
+		if err := validateDelimiters(sep[i], r.itemDelimiter, r.mapKeyDelimiter, r.lineEnding, r.noEscape); err != nil {
+			return err
+		}
+	}
+	r.fieldDelimiter = sep[0]
+	r.levels[0] = sep[0]
+	r.fieldSeparator = nil
+	if len(sep) > 1 {
+		r.fieldSeparator = []byte(sep)
+	}
+	return nil
+}
+
+// Sets whether rows are escaped, matching RowWriter.SetEscaping. Defaults to
+// true. When disabled, backslashes are read as is.
+func (r *RowReader) SetEscaping(enabled bool) {
+	r.noEscape = !enabled
+}
+
+// Sets the token read as NULL when decoding, matching RowWriter.SetNullString.
+// Defaults to an empty field; use `\N` for files written by Hive. The token
+// is compared to fields as written, before unescaping, at every nesting
+// level. ReadRow doesn't distinguish NULLs from other strings.
+func (r *RowReader) SetNullString(s string) {
+	r.nullString = s
+}
+
+// Sets the location timestamps without a zone, such as those in
+// TimestampFormat, are decoded in. Defaults to UTC.
+func (r *RowReader) SetLocation(loc *time.Location) {
+	r.location = loc
+}
+
+// Sets layouts, in time.Parse's format, to try in order when decoding a
+// timestamp that isn't in TimestampFormat or DateFormat. Layouts with a zone,
+// such as time.RFC3339, use it instead of the reader's location.
+func (r *RowReader) SetTimestampLayouts(layouts ...string) {
+	r.timestampLayouts = layouts
+}
+
+// Splits a row into its unescaped fields. A trailing line ending is optional.
+// As RowWriter follows every field with a delimiter, the delimiter after the
+// last field doesn't start another field.
+func (r *RowReader) ReadRow(row []byte) ([]string, error) {
+	raw, err := r.splitRow(row)
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]string, len(raw))
+	for i, f := range raw {
+		v, err := r.unescape(f)
+		if err != nil {
+			return nil, err
+		}
+		fields[i] = v
+	}
+	return fields, nil
+}
+
+// Reads only the given columns of a row, unescaped and in the order given.
+// The row is only split up to the last column needed, and other fields
+// aren't unescaped, so projecting a few columns of a wide row is cheap.
+// Columns past the end of the row are read as empty strings.
+func (r *RowReader) ReadColumns(row []byte, columns []int) ([]string, error) {
+	last := -1
+	for _, c := range columns {
+		if c < 0 {
+			return nil, fmt.Errorf("Invalid column %d", c)
+		}
+		if c > last {
+			last = c
+		}
+	}
+	var raw [][]byte
+	if r.partition == nil && r.expectedFields == 0 {
+		raw = r.splitRowFields(r.trimRow(row), last+1)
+	} else {
+		// Partition columns follow every field, and counting fields needs
+		// all of them.
+		var err error
+		if raw, err = r.splitRow(row); err != nil {
+			return nil, err
+		}
+	}
+
+	fields := make([]string, len(columns))
+	for i, c := range columns {
+		if c >= len(raw) {
+			continue
+		}
+		v, err := r.unescape(raw[c])
+		if err != nil {
+			return nil, err
+		}
+		fields[i] = v
+	}
+	return fields, nil
+}
+
+// Sets the number of fields every row is expected to have, not counting
+// partition columns, which catches rows corrupted by unescaped delimiters.
+// Rows with a different number are handled according to p; rejected rows are
+// errors, which Scanners handle according to their BadRowPolicy. 0, the
+// default, accepts any number of fields.
+func (r *RowReader) SetExpectedFields(n int, p FieldCountPolicy) {
+	r.expectedFields = n
+	r.fieldCountPolicy = p
+}
+
+// Sets whether an unescaped carriage return before the line ending is
+// removed, so files with Windows (\r\n) or mixed line endings are read
+// without carriage returns in their last fields. Defaults to false.
+func (r *RowReader) SetTrimCR(enabled bool) {
+	r.trimCR = enabled
+}
+
+// Removes a row's line ending, if any, and a preceding carriage return if
+// SetTrimCR is enabled.
+func (r *RowReader) trimRow(row []byte) []byte {
+	row = bytes.TrimSuffix(row, []byte{r.lineEnding})
+	if !r.trimCR || len(row) == 0 || row[len(row)-1] != '\r' {
+		return row
+	}
+	backslashes := 0
+	for i := len(row) - 2; i >= 0 && row[i] == '\\' && !r.noEscape; i-- {
+		backslashes++
+	}
+	if backslashes%2 == 1 {
+		// Escaped
+		return row
+	}
+	return row[:len(row)-1]
+}
+
+// Splits a row, with or without its line ending, into its escaped fields
+// followed by any partition values. Rows without the expected number of
+// fields are fixed or rejected according to the FieldCountPolicy.
+func (r *RowReader) splitRow(row []byte) ([][]byte, error) {
+	row = r.trimRow(row)
+	var fields [][]byte
+	if r.fieldSeparator == nil {
+		fields = r.split(row, r.fieldDelimiter)
+	} else {
+		fields = r.splitRowFields(row, -1)
+	}
+	if n := r.expectedFields; n > 0 && len(fields) != n {
+		switch {
+		case len(fields) < n && r.fieldCountPolicy == FieldCountPad:
+			for len(fields) < n {
+				fields = append(fields, []byte(r.nullString))
+			}
+		case len(fields) > n && r.fieldCountPolicy == FieldCountTruncate:
+			fields = fields[:n]
+		default:
+			return nil, fmt.Errorf("Row has %d fields but %d were expected", len(fields), n)
+		}
+	}
+	return append(fields, r.partition...), nil
+}
+
+// Returns the number of fields splitRow returns for a row, even if it's
+// rejected for having the wrong number of fields.
+func (r *RowReader) rowWidth(row []byte) int {
+	if r.expectedFields > 0 {
+		return r.expectedFields + len(r.partition)
+	}
+	fields, _ := r.splitRow(row)
+	return len(fields)
+}
+
+// Splits a row without its line ending into at most n escaped fields, or all
+// of them if n is negative, stopping at the nth field delimiter.
+func (r *RowReader) splitRowFields(row []byte, n int) [][]byte {
+	sep := r.fieldSeparator
+	if sep == nil {
+		sep = []byte{r.fieldDelimiter}
+	}
+	var fields [][]byte
+	for len(row) > 0 && len(fields) != n {
+		i := r.indexSeparator(row, sep)
+		if i < 0 {
+			fields = append(fields, row)
+			break
+		}
+		fields = append(fields, row[:i])
+		row = row[i+len(sep):]
+	}
+	return fields
+}
+
+// Returns the index of the first unescaped sep in b, or -1.
+func (r *RowReader) indexSeparator(b, sep []byte) int {
+	if len(sep) == 1 {
+		return r.index(b, sep[0])
+	}
+	if r.noEscape {
+		return bytes.Index(b, sep)
+	}
+	for i := 0; i < len(b); i++ {
+		if b[i] == '\\' {
+			i++
+		} else if bytes.HasPrefix(b[i:], sep) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Splits b on delim, which is only a separator where it isn't escaped. A
+// trailing empty element is dropped.
+func (r *RowReader) split(b []byte, delim byte) [][]byte {
+	if !r.noEscape {
+		return splitFields(b, delim)
+	}
+	parts := bytes.Split(b, []byte{delim})
+	if len(parts[len(parts)-1]) == 0 {
+		parts = parts[:len(parts)-1]
+	}
+	return parts
+}
+
+// Reverses the escaping of a field, if enabled.
+func (r *RowReader) unescape(b []byte) (string, error) {
+	if r.noEscape {
+		return string(b), nil
+	}
+	return unescape(b)
+}
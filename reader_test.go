@@ -0,0 +1,182 @@
+package hadoopfiles
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRowReaderRoundTrip(t *testing.T) {
+	rows := [][]string{
+		{"a", "b\x01c", "d\\", ""},
+		{"line\nbreak", "\x02\x03\x04", `\x01`, "ünï​code"},
+		{""},
+	}
+	for _, delims := range []Delimiters{DefaultDelimiters, {Field: '|', Item: ',', MapKey: ':', Line: '\n'}} {
+		w := NewRowWriter()
+		r := NewRowReader()
+		if err := w.SetDelimiters(delims.Field, delims.Item, delims.MapKey, delims.Line); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.SetDelimiters(delims.Field, delims.Item, delims.MapKey, delims.Line); err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range rows {
+			fields, err := r.ReadRow(w.WriteStringRow(row))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(fields, row) {
+				t.Errorf("Expected: %q !=\nActual:   %q", row, fields)
+			}
+		}
+	}
+
+	r := NewRowReader()
+	if err := r.SetDelimiters('a', 2, 3, '\n'); err == nil {
+		t.Error("Expected invalid delimiters to fail")
+	}
+	if _, err := r.ReadRow([]byte("bad\\")); err == nil {
+		t.Error("Expected an error for a trailing backslash")
+	}
+
+	r.SetEscaping(false)
+	fields, err := r.ReadRow([]byte("a\\\x01b\x01\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"a\\", "b"}; !reflect.DeepEqual(fields, expected) {
+		t.Errorf("Expected: %q !=\nActual:   %q", expected, fields)
+	}
+}
+
+func TestReadColumns(t *testing.T) {
+	w := NewRowWriter()
+	row := w.WriteStringRow([]string{"a", "b\x01", "c", "d"})
+	fields, err := NewRowReader().ReadColumns(row, []int{3, 1, 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"d", "b\x01", ""}; !reflect.DeepEqual(fields, expected) {
+		t.Errorf("Expected: %q !=\nActual:   %q", expected, fields)
+	}
+
+	// Fields after the last column aren't unescaped.
+	fields, err = NewRowReader().ReadColumns([]byte("a\x01\\x\x01"), []int{0})
+	if err != nil || !reflect.DeepEqual(fields, []string{"a"}) {
+		t.Errorf("Unexpected fields %q: %v", fields, err)
+	}
+	if _, err := NewRowReader().ReadColumns(row, []int{-1}); err == nil {
+		t.Error("Expected an error for a negative column")
+	}
+
+	sc := NewScanner(bytes.NewReader(row))
+	sc.SetColumns([]int{2})
+	if !sc.Scan() || !reflect.DeepEqual(sc.Fields(), []string{"c"}) {
+		t.Errorf("Unexpected scanned fields %q: %v", sc.Fields(), sc.Err())
+	}
+}
+
+func TestSetFieldSeparator(t *testing.T) {
+	r := NewRowReader()
+	if err := r.SetDelimiters('\t', ',', ':', '\n'); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetFieldSeparator("||"); err != nil {
+		t.Fatal(err)
+	}
+	fields, err := r.ReadRow([]byte("a|b||\\||c||||d,e\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"a|b", "||c", "", "d,e"}; !reflect.DeepEqual(fields, expected) {
+		t.Errorf("Expected: %q !=\nActual:   %q", expected, fields)
+	}
+	if fields, _ := r.ReadColumns([]byte("a||b||c"), []int{1}); !reflect.DeepEqual(fields, []string{"b"}) {
+		t.Errorf("Unexpected projected fields: %q", fields)
+	}
+
+	var dst struct {
+		A    string
+		Tags []string
+	}
+	if err := r.DecodeRow([]byte("x||y,z||\n"), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.A != "x" || !reflect.DeepEqual(dst.Tags, []string{"y", "z"}) {
+		t.Errorf("Unexpected decoded struct: %+v", dst)
+	}
+
+	for _, sep := range []string{"", "|,", "\\|"} {
+		if err := r.SetFieldSeparator(sep); err == nil {
+			t.Errorf("Expected an error for separator %q", sep)
+		}
+	}
+}
+
+func TestSetTrimCR(t *testing.T) {
+	sc := NewScanner(strings.NewReader("a\x01b\r\nc\x01\nd\\\r\r\ne\x01\r"))
+	sc.SetTrimCR(true)
+	var rows [][]string
+	for sc.Scan() {
+		rows = append(rows, sc.Fields())
+	}
+	if expected := [][]string{{"a", "b"}, {"c"}, {"d\r"}, {"e"}}; !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected: %q !=\nActual:   %q", expected, rows)
+	}
+
+	fields, err := NewRowReader().ReadRow([]byte("a\x01b\r\n"))
+	if err != nil || !reflect.DeepEqual(fields, []string{"a", "b\r"}) {
+		t.Errorf("Expected carriage returns to be kept by default: %q %v", fields, err)
+	}
+}
+
+func TestSetExpectedFields(t *testing.T) {
+	short, long := []byte("a\x01\n"), []byte("a\x01b\x01c\x01\n")
+	for _, tc := range []struct {
+		policy      FieldCountPolicy
+		short, long []string // nil for an error
+	}{
+		{FieldCountError, nil, nil},
+		{FieldCountPad, []string{"a", ""}, nil},
+		{FieldCountTruncate, nil, []string{"a", "b"}},
+	} {
+		r := NewRowReader()
+		r.SetExpectedFields(2, tc.policy)
+		for _, c := range []struct {
+			row      []byte
+			expected []string
+		}{{short, tc.short}, {long, tc.long}, {[]byte("x\x01y\x01"), []string{"x", "y"}}} {
+			fields, err := r.ReadRow(c.row)
+			if c.expected == nil {
+				if err == nil {
+					t.Errorf("Policy %d: expected an error for %q", tc.policy, c.row)
+				}
+			} else if err != nil || !reflect.DeepEqual(fields, c.expected) {
+				t.Errorf("Policy %d: expected %q but found %q: %v", tc.policy, c.expected, fields, err)
+			}
+		}
+	}
+
+	var dst struct {
+		A string
+		N *int
+	}
+	r := NewRowReader()
+	r.SetExpectedFields(2, FieldCountPad)
+	if err := r.DecodeRow(short, &dst); err != nil || dst.A != "a" || dst.N != nil {
+		t.Errorf("Expected a padded NULL: %+v %v", dst, err)
+	}
+
+	sc := NewScanner(bytes.NewReader(append(append([]byte{}, long...), short...)))
+	sc.SetExpectedFields(1, FieldCountError)
+	sc.SetBadRowPolicy(ReplaceWithNulls)
+	var rows [][]string
+	for sc.Scan() {
+		rows = append(rows, sc.Fields())
+	}
+	if expected := [][]string{{""}, {"a"}}; !reflect.DeepEqual(rows, expected) || sc.BadRows() != 1 {
+		t.Errorf("Expected %q with 1 bad row but found %q with %d", expected, rows, sc.BadRows())
+	}
+}
@@ -0,0 +1,324 @@
+package hadoopfiles
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Delimiters used for collections nested deeper than the map key delimiter.
+// These match the defaults used by Hive's LazySimpleSerDe.
+var nestedDelimiters = []byte{4, 5, 6, 7, 8}
+
+// Returns the delimiter of each nesting level for the given delimiters,
+// leaving out nested delimiters already used as one of them so a nested
+// collection can't be mistaken for a delimiter at another level. Fewer levels
+// of nesting are available as a result.
+func delimiterLevels(field, item, key, line byte) []byte {
+	levels := []byte{field, item, key}
+	for _, d := range nestedDelimiters {
+		if d != field && d != item && d != key && d != line {
+			levels = append(levels, d)
+		}
+	}
+	return levels
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	nullT        = reflect.TypeOf(Null)
+	omitT        = reflect.TypeOf(Omit)
+	rawJSONType  = reflect.TypeOf(json.RawMessage(nil))
+	rawBytesType = reflect.TypeOf(RawBytes(nil))
+	hiveRowType  = reflect.TypeOf((*HiveRow)(nil)).Elem()
+	orderedType  = reflect.TypeOf((*OrderedMap)(nil)).Elem()
+	nullableType = reflect.TypeOf((*nullable)(nil)).Elem()
+)
+
+// Returns the delimiter used at a nesting level: 0 is the field delimiter, 1
+// the item delimiter, 2 the map key delimiter, and deeper levels use
+// nestedDelimiters. Records an error and returns false if the level exceeds
+// the maximum nesting depth or there are no delimiters left.
+func (w *RowWriter) delimiter(level int) (byte, bool) {
+	if level >= w.maxDepth || level >= len(w.levels) {
+		w.setErr(fmt.Errorf("Value is nested deeper than the maximum nesting depth of %d", w.maxDepth+w.depthOffset))
+		return 0, false
+	}
+	return w.levels[level], true
+}
+
+// Writes an arbitrary value as a field using reflection. Slices and arrays
+// become Hive ARRAYs, maps become MAPs, and structs become STRUCTs of their
+// exported fields. Returns false (and writes nothing) if the value or
+// anything nested within it isn't supported.
+func (w *RowWriter) writeReflect(raw interface{}) bool {
+	start := w.buf.Len()
+	w.beginField()
+	if !w.writeValue(reflect.ValueOf(raw), 0) {
+		w.buf.Truncate(start)
+		return false
+	}
+	w.endField()
+	return true
+}
+
+// Writes the entries of a map separated by the delimiter one level deeper than
+// the map, with keys and values separated by the delimiter two levels deeper.
+func (w *RowWriter) writeMap(v reflect.Value, level int) bool {
+	itemDelim, ok := w.delimiter(level + 1)
+	if !ok {
+		return false
+	}
+	keyDelim, ok := w.delimiter(level + 2)
+	if !ok {
+		return false
+	}
+	entry := func(first bool, k, v reflect.Value) bool {
+		if !first {
+			w.buf.WriteByte(itemDelim)
+		}
+		if !w.writeValue(k, level+2) {
+			return false
+		}
+		w.buf.WriteByte(keyDelim)
+		return w.writeValue(v, level+2)
+	}
+
+	if w.sortMapKeys {
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return lessKey(keys[i], keys[j]) })
+		for i, k := range keys {
+			if !entry(i == 0, k, v.MapIndex(k)) {
+				return false
+			}
+		}
+		return true
+	}
+	iter := v.MapRange()
+	for first := true; iter.Next(); first = false {
+		if !entry(first, iter.Key(), iter.Value()) {
+			return false
+		}
+	}
+	return true
+}
+
+// Writes the entries of an OrderedMap in iteration order, delimited like
+// writeMap.
+func (w *RowWriter) writeOrderedMap(m OrderedMap, level int) bool {
+	itemDelim, ok := w.delimiter(level + 1)
+	if !ok {
+		return false
+	}
+	keyDelim, ok := w.delimiter(level + 2)
+	if !ok {
+		return false
+	}
+	first, written := true, true
+	m.Range(func(k, v interface{}) bool {
+		if !first {
+			w.buf.WriteByte(itemDelim)
+		}
+		first = false
+		written = w.writeValue(reflect.ValueOf(k), level+2)
+		if written {
+			w.buf.WriteByte(keyDelim)
+			written = w.writeValue(reflect.ValueOf(v), level+2)
+		}
+		return written
+	})
+	return written
+}
+
+// Orders map keys for sorted output. time.Time keys sort chronologically and
+// keys of other kinds fall back to comparing their formatted values.
+func lessKey(a, b reflect.Value) bool {
+	if a.Type() == timeType && a.CanInterface() {
+		return a.Interface().(time.Time).Before(b.Interface().(time.Time))
+	}
+	switch a.Kind() {
+	case reflect.String:
+		return a.String() < b.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() < b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() < b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() < b.Float()
+	case reflect.Bool:
+		return !a.Bool() && b.Bool()
+	}
+	return fmt.Sprint(a) < fmt.Sprint(b)
+}
+
+// Returns true for nil interfaces and nil values of any nillable type, all
+// of which are written as NULL.
+func isNil(v reflect.Value) bool {
+	if !v.IsValid() {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		return v.IsNil()
+	}
+	return false
+}
+
+// Writes a slice or array as a field. A nil slice is written as NULL while
+// an empty slice is an empty array.
+func (w *RowWriter) writeArrayField(v reflect.Value) {
+	w.beginField()
+	if isNil(v) {
+		w.writeNullToken(0)
+	} else {
+		w.writeArray(v, 0)
+	}
+	w.endField()
+}
+
+// Writes the elements of a slice or array separated by the delimiter one
+// level deeper than the array itself. Used for arrays without a typed
+// writer, such as nested or nullable arrays.
+func (w *RowWriter) writeArray(v reflect.Value, level int) bool {
+	delim, ok := w.delimiter(level + 1)
+	if !ok {
+		return false
+	}
+	n, ok := w.limitArray(v.Len())
+	if !ok {
+		return false
+	}
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			w.buf.WriteByte(delim)
+		}
+		if !w.writeValue(v.Index(i), level+1) {
+			return false
+		}
+	}
+	return true
+}
+
+// Writes a nested HiveRow, such as an element of an ARRAY<STRUCT>, as a
+// sub-row whose fields are separated by the delimiter one level deeper.
+func (w *RowWriter) writeSubRow(r HiveRow, level int) bool {
+	if _, ok := w.delimiter(level + 1); !ok {
+		return false
+	}
+	sub := *w
+	sub.buf = bytes.NewBuffer(nil)
+	sub.levels = w.levels[level+1:]
+	sub.maxDepth = w.maxDepth - (level + 1)
+	sub.depthOffset = w.depthOffset + level + 1
+	// Levels beyond the available delimiters are caught by delimiter().
+	padded := append(sub.levels[:len(sub.levels):len(sub.levels)], 0, 0)
+	sub.fieldDelimiter, sub.itemDelimiter, sub.mapKeyDelimiter = padded[0], padded[1], padded[2]
+	sub.position = DelimiterSuffix
+	sub.err = nil
+	sub.fields = 0
+	sub.maxFields = 0
+	sub.debugAssert = false
+	if err := r.WriteHiveRow(&sub); err != nil {
+		w.setErr(err)
+	}
+	if sub.err != nil {
+		w.setErr(sub.err)
+	}
+	// Every field is followed by a delimiter; drop the last.
+	w.buf.Write(bytes.TrimSuffix(sub.buf.Bytes(), []byte{sub.fieldDelimiter}))
+	return true
+}
+
+// Writes v without a trailing delimiter. level is the nesting level of v
+// itself, so its elements are separated by the delimiter one level deeper.
+func (w *RowWriter) writeValue(v reflect.Value, level int) bool {
+	if isNil(v) {
+		w.writeNullToken(level)
+		return true
+	}
+	if v.Type().Implements(nullableType) && v.CanInterface() {
+		value, valid := v.Interface().(nullable).nullableValue()
+		if !valid {
+			w.writeNullToken(level)
+			return true
+		}
+		return w.writeValue(reflect.ValueOf(value), level)
+	}
+	if v.Type().Implements(orderedType) && v.CanInterface() {
+		return w.writeOrderedMap(v.Interface().(OrderedMap), level)
+	}
+	if level > 0 && v.Type().Implements(hiveRowType) && v.CanInterface() {
+		return w.writeSubRow(v.Interface().(HiveRow), level)
+	}
+
+	// Types that are written as scalars rather than collections.
+	switch v.Type() {
+	case timeType:
+		w.writeString(w.formatTime(v.Interface().(time.Time)))
+		return true
+	case nullT:
+		w.writeNullToken(level)
+		return true
+	case omitT:
+		// Collection elements can't be omitted
+		return false
+	case rawJSONType:
+		// JSON is text, not binary
+		w.writeString(string(v.Bytes()))
+		return true
+	case rawBytesType:
+		w.buf.Write(v.Bytes())
+		return true
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return w.writeValue(v.Elem(), level)
+	case reflect.String:
+		w.writeStringValue(v.String())
+	case reflect.Bool:
+		if v.Bool() {
+			w.buf.WriteString("TRUE")
+		} else {
+			w.buf.WriteString("FALSE")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		w.writeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		w.writeUint(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		w.writeFloat(v.Float(), v.Type().Bits(), level)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			w.writeBytes(v.Bytes())
+			return true
+		}
+		return w.writeArray(v, level)
+	case reflect.Map:
+		return w.writeMap(v, level)
+	case reflect.Struct:
+		delim, ok := w.delimiter(level + 1)
+		if !ok {
+			return false
+		}
+		order, err := columnFields(v.Type())
+		if err != nil {
+			w.setErr(err)
+			return false
+		}
+		for n, i := range order {
+			if n > 0 {
+				w.buf.WriteByte(delim)
+			}
+			if !w.writeValue(v.Field(i), level+1) {
+				return false
+			}
+		}
+	default:
+		return false
+	}
+	return true
+}
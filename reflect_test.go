@@ -0,0 +1,285 @@
+package hadoopfiles
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteFieldTime(t *testing.T) {
+	type event struct {
+		Name    string
+		At      time.Time
+		Updated *time.Time
+		Tags    []string
+		hidden  int
+	}
+	ts := time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC)
+	f := NewRowWriter()
+
+	{
+		expected := []byte("login\x022014-01-02 03:04:05\x022014-01-02 03:04:05\x02a\x03b\x01\n")
+		if !f.WriteField(event{Name: "login", At: ts, Updated: &ts, Tags: []string{"a", "b"}}) {
+			t.Fatal("WriteField failed on struct")
+		}
+		out := f.Row()
+		if !bytes.Equal(out, expected) {
+			t.Fatalf("Expected: %q !=\nActual:  %q", expected, out)
+		}
+	}
+
+	{
+		expected := []byte("2014-01-02 03:04:05\x022014-01-02 03:04:05\x01k\x032014-01-02 03:04:05\x01\n")
+		f.WriteField([]time.Time{ts, ts})
+		f.WriteField(map[string]time.Time{"k": ts})
+		out := f.Row()
+		if !bytes.Equal(out, expected) {
+			t.Fatalf("Expected: %q !=\nActual:  %q", expected, out)
+		}
+	}
+}
+
+func TestWriteFieldUnsupported(t *testing.T) {
+	f := NewRowWriter()
+	f.WriteString("a")
+	if f.WriteField(struct{ C chan int }{}) {
+		t.Fatal("WriteField should have failed on a chan")
+	}
+	out := f.Row()
+	if !bytes.Equal(out, []byte("a\x01\n")) {
+		t.Fatalf("Partial field should not have been written: %q", out)
+	}
+}
+
+func TestWriteFieldErr(t *testing.T) {
+	f := NewRowWriter()
+	if err := f.WriteFieldErr([]int{1}); err != nil {
+		t.Fatal(err)
+	}
+	err := f.WriteFieldErr(make(chan int))
+	var typeErr *UnsupportedTypeError
+	if !errors.As(err, &typeErr) {
+		t.Fatalf("Expected an *UnsupportedTypeError but found: %v", err)
+	}
+	if typeErr.Type != reflect.TypeOf(make(chan int)) {
+		t.Errorf("Unexpected type: %v", typeErr.Type)
+	}
+	if _, err := f.FieldBytes(map[string]func(){"a": nil}); !errors.As(err, &typeErr) {
+		t.Errorf("Expected an *UnsupportedTypeError from FieldBytes but found: %v", err)
+	}
+
+	f.SetMaxNestingDepth(2)
+	if err := f.WriteFieldErr([][]int{{1}}); errors.As(err, &typeErr) || err == nil {
+		t.Errorf("Expected a nesting depth error but found: %v", err)
+	}
+	if out, expected := f.Row(), "1\x01\n"; string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+}
+
+func TestWriteFieldArrays(t *testing.T) {
+	f := NewRowWriter()
+	expected := []byte("TRUE\x02FALSE\x011.500000\x02-2.000000\x013\x02-4\x01a\x02b\x015\x026\x01\n")
+	f.WriteField([]bool{true, false})
+	f.WriteField([]float64{1.5, -2})
+	f.WriteField([]int64{3, -4})
+	f.WriteField([]string{"a", "b"})
+	f.WriteField([]int{5, 6})
+	out := f.Row()
+	if !bytes.Equal(out, expected) {
+		t.Fatalf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+
+	// Typed methods produce identical output
+	f.WriteBoolArray([]bool{true, false})
+	f.WriteFloatArray([]float64{1.5, -2})
+	f.WriteField([]int64{3, -4})
+	f.WriteStrArray([]string{"a", "b"})
+	f.WriteIntArray([]int{5, 6})
+	out = f.Row()
+	if !bytes.Equal(out, expected) {
+		t.Fatalf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+}
+
+func TestWriteFieldMapOfArrays(t *testing.T) {
+	f := NewRowWriter()
+	f.SetSortMapKeys(true)
+	f.WriteField(map[int][]string{2: {"c"}, 1: {"a", "b\x04"}})
+	f.WriteField(map[string][]int{"x": {1, 2}, "y": {}, "z": nil})
+	f.WriteField(map[string][]float64{"f": {0.5}})
+	expected := "1\x03a\x04b\\x04\x022\x03c\x01x\x031\x042\x02y\x03\x02z\x03\x01f\x030.500000\x01\n"
+	if out := f.Row(); string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+}
+
+func TestWriteFieldNestedDelimiterCollision(t *testing.T) {
+	f := NewRowWriter()
+	if err := f.SetDelimiters(4, 5, 6, '\n'); err != nil {
+		t.Fatal(err)
+	}
+	m := map[string][]int{"a": {1, 2}}
+	f.WriteField(m)
+	row := f.Row()
+	// The array nested in the map skips \x04, the field delimiter
+	if expected := "a\x061\x072\x04\n"; string(row) != expected {
+		t.Fatalf("Expected: %q !=\nActual:  %q", expected, row)
+	}
+
+	r := NewRowReader()
+	if err := r.SetDelimiters(4, 5, 6, '\n'); err != nil {
+		t.Fatal(err)
+	}
+	var out struct{ M map[string][]int }
+	if err := r.DecodeRow(row, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out.M, m) {
+		t.Errorf("Expected: %v !=\nActual:  %v", m, out.M)
+	}
+}
+
+type testOrderedMap []struct {
+	k string
+	v interface{}
+}
+
+func (m testOrderedMap) Range(fn func(k, v interface{}) bool) {
+	for _, e := range m {
+		if !fn(e.k, e.v) {
+			return
+		}
+	}
+}
+
+func TestWriteFieldOrderedMap(t *testing.T) {
+	m := testOrderedMap{{"z", 1}, {"a", []int{2, 3}}, {"m\x02", nil}}
+	f := NewRowWriter()
+	f.SetSortMapKeys(true) // ignored for ordered maps
+	if !f.WriteField(m) {
+		t.Fatal("WriteField failed on an OrderedMap")
+	}
+	f.WriteField([]testOrderedMap{{{"k", "v"}}})
+	expected := "z\x031\x02a\x032\x043\x02m\\x02\x03\x01k\x04v\x01\n"
+	if out := f.Row(); string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+
+	if f.WriteField(testOrderedMap{{"a", 1}, {"b", make(chan int)}, {"c", 2}}) {
+		t.Error("WriteField should fail on unsupported values")
+	}
+}
+
+func TestWriteFieldHiveRowSlice(t *testing.T) {
+	f := NewRowWriter()
+	rows := []HiveRow{
+		testHiveRow{1, "one", []string{"a", "b"}},
+		testHiveRow{2, "two\x03", nil},
+	}
+	expected := []byte("1\x03one\x03a\x04b\x022\x03two\\x03\x03\x01\n")
+	if !f.WriteField(rows) {
+		t.Fatal("WriteField failed on []HiveRow")
+	}
+	if out := f.Row(); !bytes.Equal(out, expected) {
+		t.Fatalf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+}
+
+func TestWriteFieldTypedNil(t *testing.T) {
+	f := NewRowWriter()
+	f.SetNullString(`\N`)
+	f.SetCollectionNullString("null")
+
+	var (
+		p *int
+		s []string
+		m map[string]int
+		i interface{}
+		r *testHiveRow
+	)
+	for _, v := range []interface{}{p, s, m, i, r, []byte(nil), map[int][]int(nil)} {
+		if !f.WriteField(v) {
+			t.Errorf("WriteField failed on typed nil %T", v)
+		}
+	}
+	f.WriteField([]interface{}{p, s, m, i})
+	f.WriteField([]string{})
+	expected := []byte("\\N\x01\\N\x01\\N\x01\\N\x01\\N\x01\\N\x01\\N\x01null\x02null\x02null\x02null\x01\x01\n")
+	if out := f.Row(); !bytes.Equal(out, expected) {
+		t.Fatalf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+}
+
+func TestWriteFieldTimeKeys(t *testing.T) {
+	t1 := time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC)
+	t2 := t1.Add(-time.Hour)
+	m := map[time.Time]int{t1: 1, t2: 2}
+
+	f := NewRowWriter()
+	f.WriteField(m)
+	out := f.Row()
+	expected1 := []byte("2014-01-02 03:04:05\x031\x022014-01-02 02:04:05\x032\x01\n")
+	expected2 := []byte("2014-01-02 02:04:05\x032\x022014-01-02 03:04:05\x031\x01\n")
+	if !bytes.Equal(out, expected1) && !bytes.Equal(out, expected2) {
+		t.Fatalf("Neither expected output matched: %q", out)
+	}
+
+	// Sorted chronologically
+	f.SetSortMapKeys(true)
+	for i := 0; i < 10; i++ {
+		f.WriteField(m)
+		if out := f.Row(); !bytes.Equal(out, expected2) {
+			t.Fatalf("Expected: %q !=\nActual:  %q", expected2, out)
+		}
+	}
+}
+
+func TestWriteFieldNestingDepth(t *testing.T) {
+	f := NewRowWriter()
+
+	// Every delimiter level is usable by default
+	if !f.WriteField([][][][][][][]int{{{{{{{1, 2}}}}}}}) {
+		t.Fatalf("WriteField failed at the maximum depth: %v", f.Err())
+	}
+	if err := f.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !f.WriteField(map[string][]int{"a": {1}}) {
+		t.Fatalf("WriteField failed: %v", f.Err())
+	}
+	if out, expected := f.Row(), "1\x082\x01a\x031\x01\n"; string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+	if f.WriteField([][][][][][][][]int{{{{{{{{1}}}}}}}}) {
+		t.Fatal("WriteField should fail beyond the available delimiters")
+	}
+	if f.Err() == nil {
+		t.Fatal("Expected an error beyond the available delimiters")
+	}
+	f.Reset()
+
+	f.SetMaxNestingDepth(3)
+	f.WriteField([][]int{{1, 2}, {3}})
+	if err := f.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if f.WriteField([][][]int{{{1}}}) {
+		t.Fatal("WriteField should fail beyond the maximum depth")
+	}
+	if err := f.Err(); err == nil || !strings.Contains(err.Error(), "maximum nesting depth of 3") {
+		t.Fatalf("Expected a nesting depth error but found: %v", err)
+	}
+	if out, expected := f.Row(), "1\x032\x023\x01\n"; string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+
+	// Depth also applies within nested HiveRows
+	f.SetMaxNestingDepth(2)
+	if f.WriteField([]HiveRow{testHiveRow{1, "one", []string{"a"}}}) {
+		t.Fatal("WriteField should fail beyond the maximum depth")
+	}
+}
@@ -0,0 +1,112 @@
+package hadoopfiles
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Statistics for a file written by a RotatingWriter, for generating
+// manifests.
+type FileStat struct {
+	Path  string
+	Rows  int64
+	Bytes int64
+}
+
+// Writes rows to a sequence of files, starting a new file once the current
+// one reaches a size threshold. Files are only rotated at row boundaries so
+// every row lands in exactly one file.
+type RotatingWriter struct {
+	*RowWriter
+	pattern  string
+	maxBytes int64
+	f        *os.File
+	stats    []FileStat // one per file created, the last is the current file
+
+	noTrailing bool   // omit the line ending after each file's final row
+	joined     []byte // reused for rows with a leading line ending
+}
+
+// Creates a RotatingWriter writing files named by formatting pattern with a
+// sequence number starting at 0, so pattern must contain an integer verb
+// such as "part-%05d". A new file is started once the current file's size
+// reaches maxBytes.
+func NewRotatingWriter(pattern string, maxBytes int64) (*RotatingWriter, error) {
+	if name := fmt.Sprintf(pattern, 0); strings.Contains(name, "%!") || name == fmt.Sprintf(pattern, 1) {
+		return nil, fmt.Errorf("Pattern must contain a sequence number verb: %q", pattern)
+	}
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("Invalid maximum file size: %d", maxBytes)
+	}
+	return &RotatingWriter{RowWriter: NewRowWriter(), pattern: pattern, maxBytes: maxBytes}, nil
+}
+
+// Ends the current row and writes it to the current file, opening a new
+// file if needed.
+func (r *RotatingWriter) EndRow() error {
+	defer r.clearRow()
+	if err := r.Err(); err != nil {
+		return err
+	}
+	if r.f == nil {
+		path := fmt.Sprintf(r.pattern, len(r.stats))
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		r.f = f
+		r.stats = append(r.stats, FileStat{Path: path})
+	}
+	stat := &r.stats[len(r.stats)-1]
+	row := r.finishRow()
+	r.observeRow(row)
+	if r.noTrailing {
+		r.joined = leadingLineEnding(r.joined, row, stat.Rows == 0)
+		row = r.joined
+	}
+	n, err := r.f.Write(row)
+	stat.Bytes += int64(n)
+	if err != nil {
+		return err
+	}
+	stat.Rows++
+	if stat.Bytes >= r.maxBytes {
+		return r.closeFile()
+	}
+	return nil
+}
+
+// Closes the current file, if any.
+func (r *RotatingWriter) closeFile() error {
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
+
+// Sets whether the final row of each file is followed by a line ending.
+// Defaults to true. See StreamWriter.SetTrailingNewline.
+func (r *RotatingWriter) SetTrailingNewline(enabled bool) {
+	r.noTrailing = !enabled
+}
+
+// Returns the number of files written so far.
+func (r *RotatingWriter) Files() int {
+	return len(r.stats)
+}
+
+// Returns the path, row count, and size of each file written so far in the
+// order they were created. The last file's stats are final once it's
+// rotated or the writer is closed.
+func (r *RotatingWriter) FileStats() []FileStat {
+	return append([]FileStat(nil), r.stats...)
+}
+
+// Finalizes the current file. Rows in progress are discarded.
+func (r *RotatingWriter) Close() error {
+	r.Reset()
+	return r.closeFile()
+}
@@ -0,0 +1,124 @@
+package hadoopfiles
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatingWriter(t *testing.T) {
+	dir := t.TempDir()
+	r, err := NewRotatingWriter(filepath.Join(dir, "part-%05d"), 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const rows = 10
+	for i := 0; i < rows; i++ {
+		r.WriteString(fmt.Sprintf("row%d", i))
+		r.WriteInt(i)
+		if err := r.EndRow(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if r.Files() < 2 {
+		t.Fatalf("Expected multiple files but found %d", r.Files())
+	}
+
+	seen := map[string]int{}
+	for i := 0; i < r.Files(); i++ {
+		data, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("part-%05d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) == 0 || data[len(data)-1] != '\n' {
+			t.Errorf("File %d doesn't end at a row boundary: %q", i, data)
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+			seen[line]++
+		}
+	}
+	for i := 0; i < rows; i++ {
+		line := fmt.Sprintf("row%d\x01%d\x01", i, i)
+		if seen[line] != 1 {
+			t.Errorf("Expected row %q in exactly one file but found it %d times", line, seen[line])
+		}
+	}
+
+	if _, err := NewRotatingWriter(filepath.Join(dir, "fixed"), 20); err == nil {
+		t.Error("Expected an error for a pattern without a sequence number")
+	}
+}
+
+func TestRotatingWriterTrailingNewline(t *testing.T) {
+	dir := t.TempDir()
+	r, err := NewRotatingWriter(filepath.Join(dir, "part-%d"), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetTrailingNewline(false)
+	for _, row := range []string{"a", "b", "c"} {
+		r.WriteString(row)
+		if err := r.EndRow(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range []string{"a\x01\nb\x01", "c\x01"} {
+		data, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("part-%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("File %d expected: %q !=\nActual:  %q", i, expected, data)
+		}
+	}
+}
+
+func TestRotatingWriterFileStats(t *testing.T) {
+	dir := t.TempDir()
+	r, err := NewRotatingWriter(filepath.Join(dir, "part-%d"), 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const rows = 25
+	var total int64
+	for i := 0; i < rows; i++ {
+		r.WriteInt(i)
+		r.WriteString("value")
+		total += int64(len(fmt.Sprint(i)) + len("value") + 3)
+		if err := r.EndRow(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := r.FileStats()
+	if len(stats) < 2 || len(stats) != r.Files() {
+		t.Fatalf("Expected multiple files but found %d stats for %d files", len(stats), r.Files())
+	}
+	var sumRows, sumBytes int64
+	for _, stat := range stats {
+		info, err := os.Stat(stat.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() != stat.Bytes {
+			t.Errorf("%s is %d bytes but stats report %d", stat.Path, info.Size(), stat.Bytes)
+		}
+		sumRows += stat.Rows
+		sumBytes += stat.Bytes
+	}
+	if sumRows != rows || sumBytes != total {
+		t.Errorf("Expected %d rows and %d bytes but stats sum to %d rows and %d bytes", rows, total, sumRows, sumBytes)
+	}
+}
@@ -0,0 +1,56 @@
+package hadoopfiles
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+)
+
+// Sets the Scanner to return only about fraction of the rows, for profiling
+// large files. Rows are kept at random with probability fraction using rng,
+// or if rng is nil, at evenly spaced intervals starting with the first row so
+// exactly that fraction of rows is kept.
+// Rows not kept are read but not parsed. A fraction of 0 or at least 1 keeps
+// every row. Must be called before the first call to Scan.
+func (sc *Scanner) SetSampleFraction(fraction float64, rng *rand.Rand) {
+	sc.sampleFraction = fraction
+	sc.sampleRand = rng
+}
+
+// Returns whether the next row is kept by sampling.
+func (sc *Scanner) sampled() bool {
+	if sc.sampleFraction <= 0 || sc.sampleFraction >= 1 {
+		return true
+	}
+	if sc.sampleRand != nil {
+		return sc.sampleRand.Float64() < sc.sampleFraction
+	}
+	// Keep row n if the running count of rows to keep goes up with it
+	n, f := float64(sc.sampleSeen), sc.sampleFraction
+	sc.sampleSeen++
+	return math.Ceil((n+1)*f) > math.Ceil(n*f)
+}
+
+// Reads the remaining rows and returns a uniform random sample of n of them,
+// or all of them if there are fewer, using reservoir sampling so memory use
+// is bounded by n. Rows are returned in no particular order. If rng is nil
+// the randomly seeded top-level source of math/rand/v2 is used. Returns an
+// error, without reading anything, if n is negative.
+func (sc *Scanner) ReservoirSample(n int, rng *rand.Rand) ([][]string, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("Invalid sample size: %d", n)
+	}
+	intN := rand.IntN
+	if rng != nil {
+		intN = rng.IntN
+	}
+	sample := make([][]string, 0, n)
+	for seen := 0; sc.Scan(); seen++ {
+		if len(sample) < n {
+			sample = append(sample, sc.Fields())
+		} else if i := intN(seen + 1); i < n {
+			sample[i] = sc.Fields()
+		}
+	}
+	return sample, sc.Err()
+}
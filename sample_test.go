@@ -0,0 +1,83 @@
+package hadoopfiles
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"testing"
+)
+
+func testSampleData(rows int) *bytes.Buffer {
+	var data bytes.Buffer
+	for i := 0; i < rows; i++ {
+		fmt.Fprintf(&data, "%d\x01\n", i)
+	}
+	return &data
+}
+
+func TestSampleFraction(t *testing.T) {
+	sc := NewScanner(testSampleData(10))
+	sc.SetSampleFraction(0.25, nil)
+	var rows []string
+	for sc.Scan() {
+		rows = append(rows, sc.Fields()[0])
+	}
+	if expected := []string{"0", "4", "8"}; !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected stride sampling of %q but found %q", expected, rows)
+	}
+
+	for _, fraction := range []float64{0.6, 0.75, 0.9} {
+		sc := NewScanner(testSampleData(100))
+		sc.SetSampleFraction(fraction, nil)
+		n := 0
+		for sc.Scan() {
+			n++
+		}
+		if expected := int(fraction * 100); n != expected {
+			t.Errorf("Expected %d rows sampled at %v but found %d", expected, fraction, n)
+		}
+	}
+
+	sc = NewScanner(testSampleData(10000))
+	sc.SetSampleFraction(0.1, rand.New(rand.NewPCG(1, 2)))
+	n := 0
+	for sc.Scan() {
+		n++
+	}
+	if n < 800 || n > 1200 {
+		t.Errorf("Expected about 1000 sampled rows but found %d", n)
+	}
+}
+
+func TestReservoirSample(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	sample, err := NewScanner(testSampleData(1000)).ReservoirSample(10, rng)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sample) != 10 {
+		t.Fatalf("Expected 10 rows but found %d", len(sample))
+	}
+	seen := map[string]bool{}
+	for _, row := range sample {
+		if seen[row[0]] {
+			t.Errorf("Row %s sampled twice", row[0])
+		}
+		seen[row[0]] = true
+	}
+
+	sample, err = NewScanner(testSampleData(3)).ReservoirSample(10, rng)
+	if err != nil || len(sample) != 3 {
+		t.Errorf("Expected all 3 rows but found %d: %v", len(sample), err)
+	}
+
+	if _, err := NewScanner(testSampleData(3)).ReservoirSample(-1, rng); err == nil {
+		t.Error("Expected an error for a negative sample size")
+	}
+
+	sample, err = NewScanner(testSampleData(100)).ReservoirSample(10, nil)
+	if err != nil || len(sample) != 10 {
+		t.Errorf("Expected 10 rows with a nil rng but found %d: %v", len(sample), err)
+	}
+}
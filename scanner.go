@@ -0,0 +1,227 @@
+package hadoopfiles
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"iter"
+	"math/rand/v2"
+)
+
+// The default maximum size of a row read by a Scanner, far larger than
+// bufio.Scanner's default token limit.
+const DefaultMaxRowSize = 256 << 20
+
+// What to do with a row that can't be parsed, such as one with an invalid
+// escape after being truncated or corrupted.
+type BadRowPolicy int
+
+const (
+	ErrorOnBadRow    BadRowPolicy = iota // stop scanning with an error (default)
+	SkipBadRow                           // skip the row and count it
+	ReplaceWithNulls                     // read the row as all NULLs and count it
+)
+
+// Reads rows from an io.Reader, such as a Hive text file, one at a time.
+// Configure delimiters and escaping with the embedded RowReader's methods
+// before the first call to Scan.
+type Scanner struct {
+	*RowReader
+	s       *bufio.Scanner
+	started bool
+	maxRow  int
+	fields  []string
+	err     error
+	columns []int // nil reads every column
+	closer  io.Closer
+	skip    int // header lines to discard
+
+	sampleFraction float64 // 0 reads every row
+	sampleRand     *rand.Rand
+	sampleSeen     int
+
+	badRowPolicy BadRowPolicy
+	badRows      int
+
+	offset   int64 // input offset after the last row split off
+	rowStart int64 // input offset of the current row
+	split    *inputSplit
+}
+
+// Creates a Scanner with the default delimiters reading from r. Compressed
+// input isn't detected; see Decompress and OpenScanner.
+func NewScanner(r io.Reader) *Scanner {
+	sc := &Scanner{RowReader: NewRowReader(), s: bufio.NewScanner(r), maxRow: DefaultMaxRowSize}
+	sc.s.Split(sc.splitRows)
+	return sc
+}
+
+// Sets the maximum size of a row. Longer rows stop scanning with
+// bufio.ErrTooLong. Must be called before the first call to Scan.
+func (sc *Scanner) SetMaxRowSize(n int) {
+	sc.maxRow = n
+}
+
+// A bufio.SplitFunc splitting data into rows on unescaped line endings.
+func (sc *Scanner) splitRows(data []byte, atEOF bool) (int, []byte, error) {
+	i := bytes.IndexByte(data, sc.lineEnding)
+	if !sc.noEscape {
+		i = indexUnescaped(data, sc.lineEnding)
+	}
+	if i >= 0 {
+		sc.rowStart, sc.offset = sc.offset, sc.offset+int64(i+1)
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		// Final row without a line ending
+		sc.rowStart, sc.offset = sc.offset, sc.offset+int64(len(data))
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// Advances to the next row, returning false when there are no more rows or an
+// error occurred.
+func (sc *Scanner) Scan() bool {
+	for {
+		row, ok := sc.nextRow()
+		if !ok {
+			sc.fields = nil
+			return false
+		}
+		fields, err := sc.readRow(row)
+		if err == nil {
+			sc.fields = fields
+			return true
+		}
+		if !sc.badRow() {
+			sc.fields, sc.err = nil, err
+			return false
+		}
+		if sc.badRowPolicy == ReplaceWithNulls {
+			n := len(sc.columns)
+			if sc.columns == nil {
+				n = sc.rowWidth(row)
+			}
+			sc.fields = make([]string, n)
+			return true
+		}
+	}
+}
+
+// Discards the first n lines of the input, like Hive's
+// skip.header.line.count table property, so files with header rows can be
+// read directly. Must be called before the first call to Scan.
+func (sc *Scanner) SetSkipHeaderLines(n int) {
+	sc.skip = n
+}
+
+// Reads only the given columns of each row, in the order given, as
+// ReadColumns does. Fields returns one value per column. Nil, the default,
+// reads every column.
+func (sc *Scanner) SetColumns(columns []int) {
+	sc.columns = columns
+}
+
+// Reads a row's fields, projected to the columns set with SetColumns.
+func (sc *Scanner) readRow(row []byte) ([]string, error) {
+	if sc.columns == nil {
+		return sc.ReadRow(row)
+	}
+	return sc.ReadColumns(row, sc.columns)
+}
+
+// Sets how rows that can't be parsed are handled. With SkipBadRow and
+// ReplaceWithNulls scanning continues past them, and BadRows counts them.
+// Decoders also apply the policy to rows that can't be decoded.
+func (sc *Scanner) SetBadRowPolicy(p BadRowPolicy) {
+	sc.badRowPolicy = p
+}
+
+// Returns the number of rows skipped or replaced with NULLs by the
+// BadRowPolicy.
+func (sc *Scanner) BadRows() int {
+	return sc.badRows
+}
+
+// Counts a bad row, returning false if the policy is to stop with an error.
+func (sc *Scanner) badRow() bool {
+	if sc.badRowPolicy == ErrorOnBadRow {
+		return false
+	}
+	sc.badRows++
+	return true
+}
+
+// Reads the next row without its line ending. The row is only valid until
+// the next call.
+func (sc *Scanner) nextRow() ([]byte, bool) {
+	if sc.err != nil {
+		return nil, false
+	}
+	if !sc.started {
+		sc.started = true
+		sc.s.Buffer(nil, sc.maxRow)
+		skip := sc.skip
+		if sc.split != nil && sc.split.start > 0 {
+			// The partial row before the split belongs to the previous one.
+			skip = 1
+		}
+		for i := 0; i < skip; i++ {
+			if !sc.s.Scan() {
+				return nil, false
+			}
+		}
+	}
+	for sc.s.Scan() {
+		if sc.split != nil && sc.rowStart > sc.split.end {
+			return nil, false
+		}
+		if sc.sampled() {
+			return sc.s.Bytes(), true
+		}
+	}
+	return nil, false
+}
+
+// Returns an iterator over the fields of rows read from r with delims, for
+// use with range. The zero value of delims uses DefaultDelimiters. An error
+// stopping the iteration is yielded with nil fields.
+func Rows(r io.Reader, delims Delimiters) iter.Seq2[[]string, error] {
+	sc := NewScanner(r)
+	if delims == (Delimiters{}) {
+		delims = DefaultDelimiters
+	}
+	if err := sc.SetDelimiters(delims.Field, delims.Item, delims.MapKey, delims.Line); err != nil {
+		return func(yield func([]string, error) bool) { yield(nil, err) }
+	}
+	return sc.Rows()
+}
+
+// Returns an iterator over the fields of the remaining rows, for use with
+// range. An error stopping the iteration is yielded with nil fields.
+func (sc *Scanner) Rows() iter.Seq2[[]string, error] {
+	return func(yield func([]string, error) bool) {
+		for sc.Scan() {
+			if !yield(sc.Fields(), nil) {
+				return
+			}
+		}
+		if err := sc.Err(); err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// Returns the unescaped fields of the current row.
+func (sc *Scanner) Fields() []string {
+	return sc.fields
+}
+
+// Returns the error, if any, that stopped scanning.
+func (sc *Scanner) Err() error {
+	if sc.err != nil {
+		return sc.err
+	}
+	return sc.s.Err()
+}
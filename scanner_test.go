@@ -0,0 +1,128 @@
+package hadoopfiles
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScanner(t *testing.T) {
+	rows := [][]string{
+		{"a", "b;c", "d\\"},
+		{strings.Repeat("x;", 100000)}, // larger than bufio.MaxScanTokenSize
+		{"", "last"},
+	}
+	w := NewRowWriter()
+	if err := w.SetDelimiters('|', ',', ':', ';'); err != nil {
+		t.Fatal(err)
+	}
+	var data bytes.Buffer
+	for _, row := range rows {
+		data.Write(w.WriteStringRow(row))
+	}
+	data.Truncate(data.Len() - 1) // no line ending after the final row
+
+	sc := NewScanner(&data)
+	if err := sc.SetDelimiters('|', ',', ':', ';'); err != nil {
+		t.Fatal(err)
+	}
+	i := 0
+	for ; sc.Scan(); i++ {
+		if !reflect.DeepEqual(sc.Fields(), rows[i]) {
+			t.Errorf("Row %d expected: %.40q !=\nActual: %.40q", i, rows[i], sc.Fields())
+		}
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if i != len(rows) {
+		t.Errorf("Expected %d rows but found %d", len(rows), i)
+	}
+}
+
+func TestScannerMaxRowSize(t *testing.T) {
+	sc := NewScanner(strings.NewReader(strings.Repeat("x", 100) + "\n"))
+	sc.SetMaxRowSize(50)
+	if sc.Scan() {
+		t.Fatal("Expected Scan to fail on a row over the maximum size")
+	}
+	if err := sc.Err(); err != bufio.ErrTooLong {
+		t.Errorf("Expected bufio.ErrTooLong but found: %v", err)
+	}
+}
+
+func TestScannerBadRowPolicy(t *testing.T) {
+	data := "a\x01\nb\\\x01\nc\\x\x01d\x01\ne\x01"
+	for _, tc := range []struct {
+		policy   BadRowPolicy
+		expected [][]string
+		bad      int
+	}{
+		{ErrorOnBadRow, [][]string{{"a"}, {"b\x01"}}, 0},
+		{SkipBadRow, [][]string{{"a"}, {"b\x01"}, {"e"}}, 1},
+		{ReplaceWithNulls, [][]string{{"a"}, {"b\x01"}, {"", ""}, {"e"}}, 1},
+	} {
+		sc := NewScanner(strings.NewReader(data))
+		sc.SetBadRowPolicy(tc.policy)
+		var rows [][]string
+		for sc.Scan() {
+			rows = append(rows, sc.Fields())
+		}
+		if !reflect.DeepEqual(rows, tc.expected) {
+			t.Errorf("Policy %d expected: %q !=\nActual: %q", tc.policy, tc.expected, rows)
+		}
+		if (sc.Err() != nil) != (tc.policy == ErrorOnBadRow) {
+			t.Errorf("Policy %d unexpected error: %v", tc.policy, sc.Err())
+		}
+		if sc.BadRows() != tc.bad {
+			t.Errorf("Policy %d expected %d bad rows but found %d", tc.policy, tc.bad, sc.BadRows())
+		}
+	}
+}
+
+func TestRows(t *testing.T) {
+	var rows [][]string
+	for fields, err := range Rows(strings.NewReader("a|b|\nc|\n"), Delimiters{Field: '|', Item: ',', MapKey: ':', Line: '\n'}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, fields)
+	}
+	if expected := [][]string{{"a", "b"}, {"c"}}; !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected: %q != %q", expected, rows)
+	}
+
+	var errs int
+	for _, err := range Rows(strings.NewReader("a\x01\nb\\x\x01\nc\x01\n"), Delimiters{}) {
+		if err != nil {
+			errs++
+		}
+	}
+	if errs != 1 {
+		t.Errorf("Expected a single error but found %d", errs)
+	}
+
+	for range Rows(strings.NewReader("a\x01\nb\x01\n"), Delimiters{}) {
+		break // stopping early must not panic
+	}
+}
+
+func TestScannerSkipHeaderLines(t *testing.T) {
+	sc := NewScanner(strings.NewReader("id\x01name\x01\nunits\x01\n1\x01a\x01\n"))
+	sc.SetSkipHeaderLines(2)
+	var rows [][]string
+	for sc.Scan() {
+		rows = append(rows, sc.Fields())
+	}
+	if expected := [][]string{{"1", "a"}}; !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected: %q != %q", expected, rows)
+	}
+
+	sc = NewScanner(strings.NewReader("header\n"))
+	sc.SetSkipHeaderLines(3)
+	if sc.Scan() || sc.Err() != nil {
+		t.Errorf("Expected no rows and no error: %v", sc.Err())
+	}
+}
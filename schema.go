@@ -0,0 +1,167 @@
+package hadoopfiles
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// A named column of a table.
+type Column struct {
+	Name string
+	Type HiveType
+}
+
+// Describes a table and how its rows are written: its ordered columns,
+// delimiters, whether values are escaped, and its NULL token. Writers,
+// readers, and DDL for the table can all be created from it so they agree.
+type Schema struct {
+	Columns []Column
+
+	// The zero value uses DefaultDelimiters.
+	Delimiters Delimiters
+
+	// Disables escaping as SetEscaping(false) does.
+	NoEscaping bool
+
+	// The NULL token, as SetNullString sets. Defaults to an empty field.
+	NullString string
+}
+
+// Returns a Schema with a column for each field of sample's struct type that
+// WriteStruct writes, in the same order, named by its lowercased field name
+// and typed as HiveTypeOf returns, and the default delimiters.
+func SchemaOf(sample interface{}) (Schema, error) {
+	t := reflect.TypeOf(sample)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return Schema{}, fmt.Errorf("Schema sample must be a struct: %T", sample)
+	}
+	cols, err := structColumns(t)
+	if err != nil {
+		return Schema{}, err
+	}
+	return Schema{Columns: cols}, nil
+}
+
+// Returns the names of the columns in order.
+func (s Schema) Names() []string {
+	names := make([]string, len(s.Columns))
+	for i, c := range s.Columns {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// Returns the types of the columns in order, such as for WriteTypedRow and
+// ReadTypedRow.
+func (s Schema) Types() []HiveType {
+	types := make([]HiveType, len(s.Columns))
+	for i, c := range s.Columns {
+		types[i] = c.Type
+	}
+	return types
+}
+
+// Checks that every column has a unique (case insensitive, as in Hive) name
+// and a valid Hive type, including parameterized types such as DECIMAL(10,2)
+// and VARCHAR(64), and nested ARRAY, MAP, and STRUCT types.
+func (s Schema) Validate() error {
+	var errs []error
+	seen := make(map[string]bool, len(s.Columns))
+	for i, c := range s.Columns {
+		name := strings.ToLower(c.Name)
+		switch {
+		case name == "":
+			errs = append(errs, fmt.Errorf("Column %d has no name", i))
+		case seen[name]:
+			errs = append(errs, fmt.Errorf("Column %d: duplicate name %s", i, c.Name))
+		}
+		seen[name] = true
+		if _, err := parseHiveType(string(c.Type)); err != nil {
+			errs = append(errs, fmt.Errorf("Column %d (%s): %v", i, c.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Returns the delimiters, substituting DefaultDelimiters for the zero value.
+func (s Schema) delimiters() Delimiters {
+	if s.Delimiters == (Delimiters{}) {
+		return DefaultDelimiters
+	}
+	return s.Delimiters
+}
+
+// Returns a RowWriter configured for the schema.
+func (s Schema) NewWriter() (*RowWriter, error) {
+	w := NewRowWriter()
+	if err := w.SetEscaping(!s.NoEscaping); err != nil {
+		return nil, err
+	}
+	d := s.delimiters()
+	if err := w.SetDelimiters(d.Field, d.Item, d.MapKey, d.Line); err != nil {
+		return nil, err
+	}
+	w.SetNullString(s.NullString)
+	return w, nil
+}
+
+// Returns a RowReader configured for the schema, expecting one field per
+// column if there are any.
+func (s Schema) NewReader() (*RowReader, error) {
+	r := NewRowReader()
+	r.SetEscaping(!s.NoEscaping)
+	d := s.delimiters()
+	if err := r.SetDelimiters(d.Field, d.Item, d.MapKey, d.Line); err != nil {
+		return nil, err
+	}
+	r.SetNullString(s.NullString)
+	r.SetExpectedFields(len(s.Columns), FieldCountError)
+	return r, nil
+}
+
+// Writes sampleRows as schema would and checks that every row would be read
+// back with the same number of fields: rows must have one value per column
+// and no value may contain an unescaped field delimiter or line ending. This
+// is a pre-flight check for onboarding a new data source. Returns all issues
+// found, each identifying its row and column, joined with errors.Join.
+func SchemaValidate(schema Schema, sampleRows [][]interface{}) error {
+	w, err := schema.NewWriter()
+	if err != nil {
+		return err
+	}
+	index := func(b []byte, c byte) int {
+		if w.noEscape {
+			return bytes.IndexByte(b, c)
+		}
+		return indexUnescaped(b, c)
+	}
+
+	var errs []error
+	for r, row := range sampleRows {
+		if len(schema.Columns) > 0 && len(row) != len(schema.Columns) {
+			errs = append(errs, fmt.Errorf("Row %d: %d values but %d columns", r, len(row), len(schema.Columns)))
+		}
+		for c, v := range row {
+			b, err := w.FieldBytes(v)
+			if err == nil {
+				err = w.Err()
+			}
+			w.Reset()
+			switch {
+			case err != nil:
+				errs = append(errs, fmt.Errorf("Row %d column %d: %v", r, c, err))
+			case index(b, w.fieldDelimiter) >= 0:
+				errs = append(errs, fmt.Errorf("Row %d column %d: value contains the field delimiter %q", r, c, w.fieldDelimiter))
+			case index(b, w.lineEnding) >= 0:
+				errs = append(errs, fmt.Errorf("Row %d column %d: value contains the line ending %q", r, c, w.lineEnding))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,107 @@
+package hadoopfiles
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	schema := Schema{
+		Columns: []Column{{"id", HiveInt}, {"name", HiveString}, {"tags", "ARRAY<STRING>"}},
+	}
+	rows := [][]interface{}{
+		{1, "plain", []string{"a"}},
+		{2, "has\x01delimiter", []string{"b\nc"}},
+	}
+	if err := SchemaValidate(schema, rows); err != nil {
+		t.Fatalf("Escaped rows should validate: %v", err)
+	}
+
+	schema.NoEscaping = true
+	err := SchemaValidate(schema, rows)
+	if err == nil {
+		t.Fatal("Expected unescaped delimiters to fail validation")
+	}
+	for _, issue := range []string{
+		`Row 1 column 1: value contains the field delimiter '\x01'`,
+		`Row 1 column 2: value contains the line ending '\n'`,
+	} {
+		if !strings.Contains(err.Error(), issue) {
+			t.Errorf("Expected %q in:\n%v", issue, err)
+		}
+	}
+	if strings.Contains(err.Error(), "Row 0") {
+		t.Errorf("Row 0 shouldn't have any issues:\n%v", err)
+	}
+
+	err = SchemaValidate(schema, [][]interface{}{{1, "a"}, {1, "b", make(chan int)}})
+	if err == nil || !strings.Contains(err.Error(), "Row 0: 2 values but 3 columns") ||
+		!strings.Contains(err.Error(), "Row 1 column 2: Unsupported type") {
+		t.Errorf("Unexpected validation result: %v", err)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	type row struct {
+		ID   int64
+		Name string
+		Tags map[string][]int
+	}
+	schema, err := SchemaOf(&row{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := schema.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if names := schema.Names(); !reflect.DeepEqual(names, []string{"id", "name", "tags"}) {
+		t.Errorf("Unexpected names: %q", names)
+	}
+	if types := schema.Types(); !reflect.DeepEqual(types, []HiveType{HiveBigInt, HiveString, "MAP<STRING,ARRAY<BIGINT>>"}) {
+		t.Errorf("Unexpected types: %q", types)
+	}
+
+	schema.Columns = append(schema.Columns, Column{"price", "DECIMAL(10,2)"}, Column{"code", "varchar(8)"})
+	schema.Delimiters = Delimiters{Field: '|', Item: ',', MapKey: ':', Line: '\n'}
+	schema.NullString = `\N`
+	w, err := schema.NewWriter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteInt(1)
+	w.WriteString("a")
+	w.WriteNull()
+	w.WriteString("12.50")
+	w.WriteString("abc")
+	row1 := w.Row()
+	if string(row1) != `1|a|\N|12.50|abc|`+"\n" {
+		t.Errorf("Unexpected row: %q", row1)
+	}
+
+	r, err := schema.NewReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := r.ReadTypedRow(row1, schema.Types())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []interface{}{int64(1), "a", nil, "12.50", "abc"}; !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected: %#v\nActual:   %#v", expected, values)
+	}
+	if _, err := r.ReadRow([]byte("1|a|\n")); err == nil {
+		t.Error("Expected the reader to reject a row without a field per column")
+	}
+
+	bad := Schema{Columns: []Column{{"a", HiveInt}, {"A", HiveString}, {"", HiveString}, {"d", "DECIMAL(5,6)"}}}
+	err = bad.Validate()
+	for _, issue := range []string{"Column 1: duplicate name A", "Column 2 has no name", "Column 3 (d)"} {
+		if err == nil || !strings.Contains(err.Error(), issue) {
+			t.Errorf("Expected %q in: %v", issue, err)
+		}
+	}
+	if _, err := SchemaOf(1); err == nil {
+		t.Error("Expected an error for a non-struct sample")
+	}
+}
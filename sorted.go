@@ -0,0 +1,223 @@
+package hadoopfiles
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// Buffers rows with sort keys and writes them in key order on Flush, such as
+// for Hive bucketed tables sorted by a column. Rows with equal keys keep
+// the order they were added in. Once the buffered rows reach a size
+// threshold they're sorted and spilled to a temporary file, and Flush
+// merges the spilled runs, so memory use is bounded regardless of volume.
+type SortedBatchWriter struct {
+	*RowWriter
+	w        io.Writer
+	maxBytes int
+	dir      string
+
+	pending      []keyedRow
+	pendingBytes int
+	runs         []*os.File // spilled runs, each sorted
+}
+
+// A row and its sort key.
+type keyedRow struct {
+	key []byte
+	row []byte
+}
+
+// Creates a SortedBatchWriter with the default delimiters which writes sorted
+// rows to w, spilling buffered rows to temporary files once they total
+// maxBytes. Set the fields' formatting with the embedded RowWriter's options.
+func NewSortedBatchWriter(w io.Writer, maxBytes int) *SortedBatchWriter {
+	return &SortedBatchWriter{RowWriter: NewRowWriter(), w: w, maxBytes: maxBytes}
+}
+
+// Sets the directory for spilled runs. Defaults to os.TempDir.
+func (s *SortedBatchWriter) SetTempDir(dir string) {
+	s.dir = dir
+}
+
+// Writes fields as a row, with WriteField, and buffers it to be written in
+// the order of key. Nothing is buffered if a field can't be written.
+func (s *SortedBatchWriter) AddKeyed(key []byte, fields ...interface{}) error {
+	for i, f := range fields {
+		if !s.WriteField(f) {
+			s.Reset()
+			return fmt.Errorf("Unsupported type for field %d: %T", i, f)
+		}
+	}
+	if err := s.Err(); err != nil {
+		s.Reset()
+		return err
+	}
+	r := keyedRow{key: append([]byte(nil), key...), row: s.Row()}
+	s.pending = append(s.pending, r)
+	s.pendingBytes += len(r.key) + len(r.row)
+	if s.pendingBytes >= s.maxBytes {
+		return s.spill()
+	}
+	return nil
+}
+
+// Sorts the buffered rows by key, preserving the order of equal keys.
+func (s *SortedBatchWriter) sortPending() {
+	sort.SliceStable(s.pending, func(i, j int) bool {
+		return bytes.Compare(s.pending[i].key, s.pending[j].key) < 0
+	})
+}
+
+// Sorts and writes the buffered rows to a new temporary file as a run of
+// length-prefixed keys and rows.
+func (s *SortedBatchWriter) spill() error {
+	f, err := os.CreateTemp(s.dir, "hadoopfiles-sort-")
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, f)
+
+	s.sortPending()
+	bw := bufio.NewWriter(f)
+	var scratch []byte
+	for _, r := range s.pending {
+		scratch = binary.AppendUvarint(scratch[:0], uint64(len(r.key)))
+		scratch = append(scratch, r.key...)
+		scratch = binary.AppendUvarint(scratch, uint64(len(r.row)))
+		scratch = append(scratch, r.row...)
+		if _, err := bw.Write(scratch); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	s.pending, s.pendingBytes = s.pending[:0], 0
+	_, err = f.Seek(0, io.SeekStart)
+	return err
+}
+
+// Writes all rows added since the last Flush in key order and removes any
+// temporary files.
+func (s *SortedBatchWriter) Flush() error {
+	defer s.removeRuns()
+	if len(s.runs) == 0 {
+		s.sortPending()
+		for _, r := range s.pending {
+			if _, err := s.w.Write(r.row); err != nil {
+				return err
+			}
+		}
+		s.pending, s.pendingBytes = s.pending[:0], 0
+		return nil
+	}
+
+	if len(s.pending) > 0 {
+		if err := s.spill(); err != nil {
+			return err
+		}
+	}
+	return s.merge()
+}
+
+// Merges the spilled runs into the underlying writer.
+func (s *SortedBatchWriter) merge() error {
+	h := make(runHeap, 0, len(s.runs))
+	for i, f := range s.runs {
+		r := &run{r: bufio.NewReader(f), index: i}
+		if err := r.next(); err != nil {
+			return err
+		}
+		if r.cur != nil {
+			h = append(h, r)
+		}
+	}
+	heap.Init(&h)
+	for len(h) > 0 {
+		r := h[0]
+		if _, err := s.w.Write(r.cur.row); err != nil {
+			return err
+		}
+		if err := r.next(); err != nil {
+			return err
+		}
+		if r.cur == nil {
+			heap.Pop(&h)
+		} else {
+			heap.Fix(&h, 0)
+		}
+	}
+	return nil
+}
+
+// Closes and deletes the spilled runs.
+func (s *SortedBatchWriter) removeRuns() {
+	for _, f := range s.runs {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	s.runs = nil
+}
+
+// A spilled run being merged.
+type run struct {
+	r     *bufio.Reader
+	index int       // order the run was spilled in, for stable merging
+	cur   *keyedRow // nil once the run is exhausted
+}
+
+// Reads the next row of the run into cur.
+func (r *run) next() error {
+	key, err := readPrefixed(r.r)
+	if err == io.EOF {
+		r.cur = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	row, err := readPrefixed(r.r)
+	if err != nil {
+		return fmt.Errorf("Truncated sort run: %v", err)
+	}
+	r.cur = &keyedRow{key: key, row: row}
+	return nil
+}
+
+// Reads a uvarint length followed by that many bytes.
+func readPrefixed(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// A min-heap of runs by their current key, then spill order.
+type runHeap []*run
+
+func (h runHeap) Len() int { return len(h) }
+func (h runHeap) Less(i, j int) bool {
+	if c := bytes.Compare(h[i].cur.key, h[j].cur.key); c != 0 {
+		return c < 0
+	}
+	return h[i].index < h[j].index
+}
+func (h runHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x interface{}) { *h = append(*h, x.(*run)) }
+func (h *runHeap) Pop() interface{} {
+	old := *h
+	r := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return r
+}
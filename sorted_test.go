@@ -0,0 +1,67 @@
+package hadoopfiles
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestSortedBatchWriter(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewSortedBatchWriter(&buf, 1<<20)
+	for i, k := range []string{"c", "a", "b", "a"} {
+		if err := s.AddKeyed([]byte(k), k, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("Rows written before Flush: %q", buf.Bytes())
+	}
+	if err := s.AddKeyed([]byte("z"), make(chan int)); err == nil {
+		t.Fatal("Expected an error for an unsupported field")
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// Equal keys keep the order they were added in
+	expected := "a\x011\x01\na\x013\x01\nb\x012\x01\nc\x010\x01\n"
+	if buf.String() != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, buf.String())
+	}
+}
+
+func TestSortedBatchWriterSpill(t *testing.T) {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	s := NewSortedBatchWriter(&buf, 64)
+	s.SetTempDir(dir)
+
+	const rows = 100
+	for i := 0; i < rows; i++ {
+		key := fmt.Sprintf("%03d", (i*37)%rows) // out of order
+		if err := s.AddKeyed([]byte(key), key, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) < 2 {
+		t.Fatalf("Expected rows to spill to multiple runs but found %d", len(entries))
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	it := NewRowIterator(buf.Bytes(), DefaultFieldDelimiter, DefaultLineEnding)
+	n := 0
+	for ; it.Next(); n++ {
+		if key := it.Fields()[0]; key != fmt.Sprintf("%03d", n) {
+			t.Fatalf("Row %d out of order: %q", n, it.Fields())
+		}
+	}
+	if n != rows {
+		t.Errorf("Expected %d rows but found %d", rows, n)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Temporary files weren't removed: %v", entries)
+	}
+}
@@ -0,0 +1,33 @@
+package hadoopfiles
+
+import (
+	"io"
+	"math"
+)
+
+// The byte range of a file a Scanner reads, as a MapReduce input split.
+type inputSplit struct {
+	start, end int64
+}
+
+// Creates a Scanner reading the rows of one split of r, the bytes from start
+// to end, so several workers can share a file as Hadoop's LineRecordReader
+// does. Unless start is 0, the row containing or starting at start is
+// skipped, as it belongs to the previous split, and every row starting at or
+// before end is read in full, even past end. Splits covering a file without
+// gaps or overlap read each row exactly once. Header lines are only skipped by
+// the split starting at 0. Escaping is only respected after start, so rows
+// must not contain escaped line endings other than as escape sequences such
+// as \n, which RowWriter always writes for a newline line ending.
+func NewSplitScanner(r io.ReaderAt, start, end int64) *Scanner {
+	sc := NewScanner(io.NewSectionReader(r, start, math.MaxInt64-start))
+	sc.offset = start
+	sc.split = &inputSplit{start: start, end: end}
+	return sc
+}
+
+// Returns the input offset of the start of the current row, counted from the
+// start of the file for Scanners created by NewSplitScanner.
+func (sc *Scanner) RowOffset() int64 {
+	return sc.rowStart
+}
@@ -0,0 +1,41 @@
+package hadoopfiles
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestSplitScanner(t *testing.T) {
+	w := NewRowWriter()
+	var data bytes.Buffer
+	var expected []string
+	for i := 0; i < 50; i++ {
+		s := fmt.Sprintf("row %d\n%s", i, bytes.Repeat([]byte("x"), i%5))
+		expected = append(expected, s)
+		data.Write(w.WriteStringRow([]string{s}))
+	}
+	r := bytes.NewReader(data.Bytes())
+
+	for _, size := range []int64{1, 7, 13, 100, int64(data.Len())} {
+		var rows []string
+		for start := int64(0); start < int64(data.Len()); start += size {
+			sc := NewSplitScanner(r, start, start+size)
+			for sc.Scan() {
+				rows = append(rows, sc.Fields()[0])
+			}
+			if err := sc.Err(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !reflect.DeepEqual(rows, expected) {
+			t.Errorf("Splits of %d bytes read %d rows:\n%q", size, len(rows), rows)
+		}
+	}
+
+	sc := NewSplitScanner(r, 0, 0)
+	if !sc.Scan() || sc.RowOffset() != 0 || sc.Scan() {
+		t.Error("Expected a split ending at 0 to read only the first row")
+	}
+}
@@ -0,0 +1,140 @@
+package hadoopfiles
+
+import (
+	"bytes"
+	"errors"
+	"hash"
+	"io"
+)
+
+var ErrRowPending = errors.New("Previous row failed to write; call RetryLast before ending another row")
+
+// Writes rows to an io.Writer as they're completed. Fields are written with
+// the embedded RowWriter's methods and each row is sent with EndRow.
+type StreamWriter struct {
+	*RowWriter
+	w      io.Writer
+	failed []byte // last row that failed to write
+
+	noTrailing bool   // omit the line ending after the final row
+	started    bool   // a row has been written
+	joined     []byte // reused for rows with a leading line ending
+
+	dedup bool   // skip rows identical to the previous row
+	last  []byte // previous row written, when dedup is enabled
+
+	written func(row []byte) // called with each row once it's been written
+}
+
+// Creates a new StreamWriter with the default delimiters writing to w.
+func NewStreamWriter(w io.Writer) *StreamWriter {
+	return &StreamWriter{RowWriter: NewRowWriter(), w: w}
+}
+
+// Ends the current row and writes it to the underlying writer with a single
+// Write call. If the write fails the row is kept so it can be re-emitted
+// with RetryLast, and no further rows may be ended until it is. Ending a row
+// meanwhile returns ErrRowPending and keeps the row, so EndRow can be called
+// again once RetryLast succeeds.
+func (s *StreamWriter) EndRow() error {
+	if s.failed != nil {
+		return ErrRowPending
+	}
+	if err := s.Err(); err != nil {
+		s.clearRow()
+		return err
+	}
+	row := s.finishRow()
+	if s.dedup && s.last != nil && bytes.Equal(row, s.last) {
+		s.clearRow()
+		return nil
+	}
+	if s.dedup {
+		s.last = append(s.last[:0], row...)
+	}
+	s.observeRow(row)
+	if s.noTrailing {
+		s.joined = leadingLineEnding(s.joined, row, !s.started)
+		row = s.joined
+	}
+	if _, err := s.w.Write(row); err != nil {
+		s.failed = append([]byte(nil), row...)
+		s.clearRow()
+		return err
+	}
+	if s.written != nil {
+		s.written(row)
+	}
+	s.started = true
+	s.clearRow()
+	return nil
+}
+
+// Sets whether the final row is followed by a line ending. Defaults to true.
+// When disabled each row's line ending is held back and written before the
+// next row, so output ends without one, which some tools would otherwise
+// read as an extra empty record.
+func (s *StreamWriter) SetTrailingNewline(enabled bool) {
+	s.noTrailing = !enabled
+}
+
+// Sets whether a row byte-identical to the row immediately before it is
+// skipped, such as for compacting repetitive logs. Rows identical to an
+// earlier, but not the previous, row are still written. Defaults to false.
+func (s *StreamWriter) SetDedupConsecutive(enabled bool) {
+	s.dedup = enabled
+}
+
+// Moves the line ending at the end of row to the front, or drops it if first
+// is true, for output that omits the line ending after the final row. The
+// result is appended to dst[:0].
+func leadingLineEnding(dst, row []byte, first bool) []byte {
+	dst = dst[:0]
+	if !first {
+		dst = append(dst, row[len(row)-1])
+	}
+	return append(dst, row[:len(row)-1]...)
+}
+
+// Writes the last row that failed to write to w, which becomes the
+// destination for all subsequent rows. Does nothing if no row failed.
+func (s *StreamWriter) RetryLast(w io.Writer) error {
+	s.w = w
+	if s.failed == nil {
+		return nil
+	}
+	if _, err := w.Write(s.failed); err != nil {
+		return err
+	}
+	if s.written != nil {
+		s.written(s.failed)
+	}
+	s.failed = nil
+	s.started = true
+	return nil
+}
+
+// A StreamWriter that writes each completed row into a hash, such as for
+// content-addressed storage, without copying rows out of the writer. Rows
+// are hashed once they've been written, so a row that fails to write is only
+// hashed when RetryLast succeeds.
+type HashingWriter struct {
+	*StreamWriter
+	h hash.Hash
+}
+
+// Creates a HashingWriter with the default delimiters writing rows into h and,
+// if w isn't nil, also to w.
+func NewHashingWriter(h hash.Hash, w io.Writer) *HashingWriter {
+	if w == nil {
+		w = io.Discard
+	}
+	s := NewStreamWriter(w)
+	s.written = func(row []byte) { h.Write(row) }
+	return &HashingWriter{StreamWriter: s, h: h}
+}
+
+// Returns the running hash of all rows written so far.
+func (w *HashingWriter) Sum() []byte {
+	return w.h.Sum(nil)
+}
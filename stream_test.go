@@ -0,0 +1,161 @@
+package hadoopfiles
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	// Simulate a partial write
+	return len(p) / 2, errors.New("disk full")
+}
+
+func TestStreamWriterRetry(t *testing.T) {
+	s := NewStreamWriter(failingWriter{})
+	s.WriteString("row1")
+	s.WriteInt(1)
+	if err := s.EndRow(); err == nil {
+		t.Fatal("Expected EndRow to fail")
+	}
+
+	s.WriteString("row2")
+	if err := s.EndRow(); err != ErrRowPending {
+		t.Fatalf("Expected ErrRowPending but found: %v", err)
+	}
+
+	out := bytes.NewBuffer(nil)
+	if err := s.RetryLast(out); err != nil {
+		t.Fatal(err)
+	}
+	// The pending row was kept
+	if err := s.EndRow(); err != nil {
+		t.Fatal(err)
+	}
+	s.WriteString("row3")
+	if err := s.EndRow(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte("row1\x011\x01\nrow2\x01\nrow3\x01\n")
+	if !bytes.Equal(out.Bytes(), expected) {
+		t.Fatalf("Expected: %q !=\nActual:  %q", expected, out.Bytes())
+	}
+}
+
+func TestHashingWriter(t *testing.T) {
+	h := NewHashingWriter(sha256.New(), nil)
+	f := NewRowWriter()
+	var all []byte
+	for i := 0; i < 3; i++ {
+		h.WriteString("row")
+		h.WriteInt(i)
+		if err := h.EndRow(); err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString("row")
+		f.WriteInt(i)
+		all = append(all, f.Row()...)
+	}
+
+	expected := sha256.Sum256(all)
+	if !bytes.Equal(h.Sum(), expected[:]) {
+		t.Fatalf("Expected hash %x but found %x", expected, h.Sum())
+	}
+}
+
+func TestHashingWriterRetry(t *testing.T) {
+	h := NewHashingWriter(sha256.New(), failingWriter{})
+	h.WriteString("row1")
+	if err := h.EndRow(); err == nil {
+		t.Fatal("Expected EndRow to fail")
+	}
+	out := bytes.NewBuffer(nil)
+	if err := h.RetryLast(out); err != nil {
+		t.Fatal(err)
+	}
+	h.WriteString("row2")
+	if err := h.EndRow(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := sha256.Sum256([]byte("row1\x01\nrow2\x01\n"))
+	if !bytes.Equal(out.Bytes(), []byte("row1\x01\nrow2\x01\n")) {
+		t.Fatalf("Unexpected output: %q", out.Bytes())
+	}
+	if !bytes.Equal(h.Sum(), expected[:]) {
+		t.Fatalf("Expected hash %x but found %x", expected, h.Sum())
+	}
+}
+
+func TestStreamWriterTrailingNewline(t *testing.T) {
+	out := bytes.NewBuffer(nil)
+	s := NewStreamWriter(out)
+	s.SetTrailingNewline(false)
+	for _, row := range []string{"a", "b", "c"} {
+		s.WriteString(row)
+		if err := s.EndRow(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if expected := "a\x01\nb\x01\nc\x01"; out.String() != expected {
+		t.Fatalf("Expected: %q !=\nActual:  %q", expected, out.String())
+	}
+}
+
+func TestStreamWriterRetryTrailingNewline(t *testing.T) {
+	s := NewStreamWriter(failingWriter{})
+	s.SetTrailingNewline(false)
+	s.WriteString("a")
+	if err := s.EndRow(); err == nil {
+		t.Fatal("Expected EndRow to fail")
+	}
+
+	out := bytes.NewBuffer(nil)
+	if err := s.RetryLast(out); err != nil {
+		t.Fatal(err)
+	}
+	s.WriteString("b")
+	if err := s.EndRow(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "a\x01\nb\x01"; out.String() != expected {
+		t.Fatalf("Expected: %q !=\nActual:  %q", expected, out.String())
+	}
+}
+
+func TestStreamWriterDedupConsecutive(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewStreamWriter(&buf)
+	s.SetDedupConsecutive(true)
+	for _, v := range []string{"a", "a", "a", "b", "a", "b", "b"} {
+		s.WriteString(v)
+		if err := s.EndRow(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if expected := "a\x01\nb\x01\na\x01\nb\x01\n"; buf.String() != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, buf.String())
+	}
+}
+
+func TestStreamWriterDedupSizeObserver(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewStreamWriter(&buf)
+	s.SetDedupConsecutive(true)
+	var sizes []int
+	s.SetRecordSizeObserver(func(size int) { sizes = append(sizes, size) })
+	for _, v := range []string{"a", "a", "bb", "bb", "a"} {
+		s.WriteString(v)
+		if err := s.EndRow(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if expected := []int{3, 4, 3}; !reflect.DeepEqual(sizes, expected) {
+		t.Errorf("Expected sizes %v but found %v", expected, sizes)
+	}
+}
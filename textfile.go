@@ -4,19 +4,151 @@ package hadoopfiles
 
 import (
 	"bytes"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 const (
 	TimestampFormat = "2006-01-02 15:04:05.999999999"
+	DateFormat      = "2006-01-02"
 
 	DefaultFieldDelimiter  = 1
 	DefaultItemDelimiter   = 2
 	DefaultMapKeyDelimiter = 3
 	DefaultLineEnding      = '\n'
+
+	// Matches the number of delimiter levels: field, item, map key, and
+	// nestedDelimiters.
+	DefaultMaxNestingDepth = 8
+)
+
+// The delimiters of a row, as passed to SetDelimiters.
+type Delimiters struct {
+	Field  byte
+	Item   byte
+	MapKey byte
+	Line   byte
+}
+
+// The default delimiters used by NewRowWriter.
+var DefaultDelimiters = Delimiters{
+	Field:  DefaultFieldDelimiter,
+	Item:   DefaultItemDelimiter,
+	MapKey: DefaultMapKeyDelimiter,
+	Line:   DefaultLineEnding,
+}
+
+// Where the field delimiter is written relative to each field's value.
+type DelimiterPosition int
+
+const (
+	DelimiterSuffix DelimiterPosition = iota // after each field (default)
+	DelimiterPrefix                          // before each field
+
+	delimiterNone DelimiterPosition = -1 // internal: no field delimiter
+)
+
+// Implemented by types that write their own fields. WriteField delegates to
+// WriteHiveRow for full control over complex rows. Nested within a collection,
+// such as in a []HiveRow, each element is written as a sub-row (a STRUCT)
+// using the delimiters one level deeper.
+type HiveRow interface {
+	WriteHiveRow(w *RowWriter) error
+}
+
+// Implemented by ordered map types, such as a slice of key/value pairs.
+// WriteField writes them as MAPs with entries in the order Range visits them,
+// regardless of SetSortMapKeys. Range should stop when fn returns false.
+type OrderedMap interface {
+	Range(fn func(k, v interface{}) bool)
+}
+
+// A string column value that may be NULL. Written as NULL when Valid is
+// false and as Value otherwise.
+type NullableString struct {
+	Value string
+	Valid bool
+}
+
+func (n NullableString) nullableValue() (interface{}, bool) {
+	return n.Value, n.Valid
+}
+
+// A column value of any type that may be NULL, such as Nullable[int] or
+// Nullable[time.Time]. Written as NULL when Valid is false and as Value, using
+// the same handling as WriteField, otherwise. Slices such as
+// []Nullable[string] are written as ARRAYs with invalid elements written as
+// the collection NULL token (see SetCollectionNullString).
+type Nullable[T any] struct {
+	Value T
+	Valid bool
+}
+
+func (n Nullable[T]) nullableValue() (interface{}, bool) {
+	return n.Value, n.Valid
+}
+
+// Implemented by nullable wrapper types.
+type nullable interface {
+	nullableValue() (v interface{}, valid bool)
+}
+
+// Bytes written verbatim by WriteField, without escaping or binary encoding,
+// like WriteRawField. The caller is responsible for ensuring they contain no
+// delimiters.
+type RawBytes []byte
+
+type nullType struct{}
+
+// Pass Null to WriteField to explicitly write a NULL field. Unlike nil it
+// can't be confused with a typed nil.
+var Null = nullType{}
+
+type omitType struct{}
+
+// Pass Omit to WriteField to skip a column entirely, writing neither a value
+// nor a delimiter, for variable-width records where a field may be absent.
+// Unlike Null, which is an empty column that's still delimited, Omit shifts
+// the following fields left. It's only valid as a field, not within a
+// collection.
+var Omit = omitType{}
+
+// How WriteVector handles NaN elements.
+type NaNPolicy int
+
+const (
+	NaNWrite NaNPolicy = iota // write NaN like any other float (default)
+	NaNSkip                   // omit NaN elements from the array
+	NaNNull                   // write NaN elements as the collection null token
+)
+
+// What array writers do with arrays longer than SetMaxArrayElements allows.
+type ArrayOverflowPolicy int
+
+const (
+	ArrayOverflowError    ArrayOverflowPolicy = iota // record an error and write nothing (default)
+	ArrayOverflowTruncate                            // write only the first elements
+)
+
+// How []byte values are encoded as text.
+type BinaryEncoding int
+
+const (
+	Base64Encoding BinaryEncoding = iota // standard base64 (default)
+	HexEncoding                          // lowercase hex
 )
 
 type RowWriter struct {
@@ -25,14 +157,57 @@ type RowWriter struct {
 	itemDelimiter   byte
 	mapKeyDelimiter byte
 	lineEnding      byte
+	levels          []byte // delimiters by nesting level, starting with field
+	maxDepth        int    // maximum nesting level, relative to depthOffset
+	depthOffset     int    // nesting level of a sub-row within its parent
 	replacer        *strings.Replacer
 	delims          string // used for checking non-UTF8 strings w/Contains
+	position        DelimiterPosition
+	fieldBuf        *bytes.Buffer // scratch buffer for FieldBytes
+	stringRow       bytes.Buffer  // the row WriteStringRow is returning
+	scratch         []byte        // reused for formatting numbers, so not goroutine safe
+
+	noEscape         bool // don't escape strings at all
+	skipLineEnding   bool // don't escape the line ending
+	escapeCR         bool // escape \r even if it isn't a delimiter
+	rejectLineEnding bool // error on unescaped line endings
+
+	nullString           string
+	collectionNullString string
+	collectionNullSet    bool // false: collections use nullString
+
+	err       error // first error encountered writing the current row
+	fields    int   // number of fields written to the current row
+	maxFields int   // 0 means unlimited
+
+	debugAssert bool
+	fieldStart  int // offset of the current field's value in buf
+	debugStyle  DebugStyle
+
+	bytesAsString   bool
+	binaryEncoding  BinaryEncoding
+	columnEncodings map[int]BinaryEncoding
+	autoDate        bool
+	sortMapKeys     bool
+	vectorNaN       NaNPolicy
+	maxArray        int
+	arrayOverflow   ArrayOverflowPolicy
+	infNaN          *[3]string // +Inf, -Inf, NaN tokens; nil uses null tokens
+	onReset         func(partial []byte)
+	sizeObserver    func(size int)
+	nullCounts      map[int]int // NULL fields by column, across rows
+	rowNulls        []int       // columns written as NULL in the current row
+	transform       func(col int, s string) string
+	normalizer      Normalizer
+	charset         Charset
+	runePolicy      UnrepresentableRunePolicy
+	runeReplacement string
 }
 
 // Creates a new RowWriter with the default delimiters. Overwrite delimiters
 // with SetDelimiters.
 func NewRowWriter() *RowWriter {
-	w := &RowWriter{buf: bytes.NewBuffer(nil)}
+	w := &RowWriter{buf: bytes.NewBuffer(nil), maxDepth: DefaultMaxNestingDepth}
 	err := w.SetDelimiters(
 		DefaultFieldDelimiter,
 		DefaultItemDelimiter,
@@ -49,175 +224,1252 @@ func NewRowWriter() *RowWriter {
 //
 // Delimiters must not have their high order bit set (be <128) and cannot be
 // lowercase ASCII letters, digits, or U. These restrictions are to prevent
-// ambiguous escape codes (escaping 'n' to "\n").
+// ambiguous escape codes (escaping 'n' to "\n"). U is allowed when escaping
+// is disabled with SetEscaping.
 func (w *RowWriter) SetDelimiters(field, item, key, line byte) error {
 	if w.buf.Len() > 0 {
 		return fmt.Errorf("Cannot set delimiters after starting to write a row.")
 	}
-	names := []string{"field", "item", "key", "line"} // used in error message
-	delims := []byte{field, item, key, line}
-	pairs := make([]string, 0, (1+len(delims))*2)
+	return w.setDelimiters(field, item, key, line)
+}
 
-	// Escape the escape character!
-	pairs = append(pairs, `\`, `\\`)
+// Drops the current row and sets new delimiters, for reusing a pooled writer
+// for a different table. If the delimiters are invalid an error is returned
+// and the writer, including the current row, is left unchanged.
+func (w *RowWriter) ResetWithDelimiters(field, item, key, line byte) error {
+	if err := w.setDelimiters(field, item, key, line); err != nil {
+		return err
+	}
+	w.Reset()
+	return nil
+}
 
-	// Used for strings.Contains when checking non-UTF8 strings
-	delimStr := string(field) + string(item) + string(key) + string(line)
+// Returns an error if the delimiters are ambiguous or can't be escaped.
+// allowU permits U, which is only used by escapes.
+func validateDelimiters(field, item, key, line byte, allowU bool) error {
+	names := []string{"field", "item", "key", "line"} // used in error message
+	delims := []byte{field, item, key, line}
 
 	if field == item || field == key || field == line || item == key || item == line || key == line {
-		return fmt.Errorf("Cannot have duplicate delimiters: %s", delimStr)
+		return fmt.Errorf("Cannot have duplicate delimiters: %s", delims)
 	}
 
 	for i, d := range delims {
-		if d > 127 || (d > 96 && d < 123) || (d > 47 && d < 58) || d == 'U' || d == '\\' {
+		if d > 127 || (d > 96 && d < 123) || (d > 47 && d < 58) || (d == 'U' && !allowU) || d == '\\' {
 			// High order bit set, lowercase ascii character, digits, or uppercase U:
-			// cannot safely replace!
+			// cannot safely replace! U is only used by escapes so it's allowed
+			// when escaping is disabled.
 			return fmt.Errorf("%q is not a valid %s delimiter", d, names[i])
 		}
-		// Add original and escaped-replacement pair to list of pairs for replacer.
-		pairs = append(pairs, string(d), escape(rune(d)))
 	}
-	w.delims = delimStr
-	w.replacer = strings.NewReplacer(pairs...)
+	return nil
+}
+
+// Validates and applies delimiters. Nothing is modified if they're invalid.
+func (w *RowWriter) setDelimiters(field, item, key, line byte) error {
+	if err := validateDelimiters(field, item, key, line, w.noEscape); err != nil {
+		return err
+	}
+	// Used for strings.Contains when checking non-UTF8 strings
+	w.delims = string(field) + string(item) + string(key) + string(line)
+	w.levels = delimiterLevels(field, item, key, line)
 	w.fieldDelimiter = field
 	w.itemDelimiter = item
 	w.mapKeyDelimiter = key
 	w.lineEnding = line
+	w.buildReplacer()
+	return nil
+}
+
+// Builds the replacer used to escape strings from the current delimiters and
+// escaping options.
+func (w *RowWriter) buildReplacer() {
+	// Escape the escape character!
+	pairs := []string{`\`, `\\`}
+
+	// Add original and escaped-replacement pair to list of pairs for replacer.
+	for _, d := range []byte{w.fieldDelimiter, w.itemDelimiter, w.mapKeyDelimiter} {
+		pairs = append(pairs, string(d), escape(rune(d)))
+	}
+	if !w.skipLineEnding {
+		pairs = append(pairs, string(w.lineEnding), escape(rune(w.lineEnding)))
+	}
+	if w.escapeCR {
+		// Harmless if \r is also a delimiter as the escapes are identical.
+		pairs = append(pairs, "\r", escape('\r'))
+	}
+	// Escape nested collection delimiters too unless they're already handled.
+	for _, d := range nestedDelimiters {
+		if !strings.ContainsRune(w.delims, rune(d)) {
+			pairs = append(pairs, string(d), escape(rune(d)))
+		}
+	}
+	w.replacer = strings.NewReplacer(pairs...)
+}
+
+// Sets whether strings are escaped. Defaults to true. Disabling escaping is
+// only safe when the caller guarantees data never contains delimiters or
+// escapes it themselves. Re-enabling escaping fails if a delimiter is U.
+func (w *RowWriter) SetEscaping(enabled bool) error {
+	if enabled && strings.IndexByte(w.delims, 'U') >= 0 {
+		return fmt.Errorf("Cannot enable escaping with %q as a delimiter", 'U')
+	}
+	w.noEscape = !enabled
+	return nil
+}
+
+// Sets whether the line ending is escaped in string fields. Defaults to true.
+// Disable it only when the line ending is guaranteed to never appear in data,
+// optionally combined with SetRejectLineEnding to verify that.
+func (w *RowWriter) SetEscapeLineEnding(enabled bool) {
+	w.skipLineEnding = !enabled
+	w.buildReplacer()
+}
+
+// Sets whether carriage returns in string fields are escaped as \r even when
+// they aren't a delimiter, for readers that treat them as line endings.
+// Defaults to false, escaping \r only when it's the line ending.
+func (w *RowWriter) SetEscapeCR(enabled bool) {
+	w.escapeCR = enabled
+	w.buildReplacer()
+}
+
+// Sets whether string fields containing the line ending record an error (see
+// Err). Only takes effect when the line ending isn't escaped.
+func (w *RowWriter) SetRejectLineEnding(enabled bool) {
+	w.rejectLineEnding = enabled
+}
+
+// Sets whether the field delimiter is written before (DelimiterPrefix) or
+// after (DelimiterSuffix, the default) each field. Some nonstandard SerDes
+// expect a leading delimiter.
+func (w *RowWriter) SetDelimiterPosition(p DelimiterPosition) error {
+	if w.buf.Len() > 0 {
+		return fmt.Errorf("Cannot set delimiter position after starting to write a row.")
+	}
+	if p != DelimiterSuffix && p != DelimiterPrefix {
+		return fmt.Errorf("Invalid delimiter position: %d", p)
+	}
+	w.position = p
 	return nil
 }
 
-// Writes a field or returns false if type isn't a supported.
+// Sets the maximum nesting depth of values written with WriteField, counting
+// the field itself as the first level. Values nested deeper record an error
+// (see Err) and aren't written, rather than overflowing the stack on cyclic
+// data or producing ambiguous output. Defaults to DefaultMaxNestingDepth,
+// which is also the maximum as there are no more delimiters beyond it.
+func (w *RowWriter) SetMaxNestingDepth(n int) {
+	w.maxDepth = n
+}
+
+// Sets the maximum number of fields allowed per row. Writing more records an
+// error (see Err) to catch bugs that emit unbounded fields. 0, the default,
+// disables the limit.
+func (w *RowWriter) SetMaxFields(n int) {
+	w.maxFields = n
+}
+
+// Enables checking each field after it's written for unescaped field
+// delimiters or line endings, recording an error (see Err) if one leaked.
+// Intended for catching escaping bugs during development; off by default.
+func (w *RowWriter) SetDebugAssert(enabled bool) {
+	w.debugAssert = enabled
+}
+
+// Records an error if a field's value contains an unescaped field delimiter
+// or line ending.
+func (w *RowWriter) assertEscaped(field []byte) {
+	for _, d := range []byte{w.fieldDelimiter, w.lineEnding} {
+		if i := indexUnescaped(field, d); i >= 0 {
+			w.setErr(fmt.Errorf("Unescaped delimiter %q at offset %d of field %d: %q", d, i, w.fields, field))
+			return
+		}
+	}
+}
+
+// Starts a field by writing the field delimiter if it's a prefix.
+func (w *RowWriter) beginField() {
+	w.fields++
+	if w.maxFields > 0 && w.fields == w.maxFields+1 {
+		w.setErr(fmt.Errorf("Row exceeds maximum of %d fields", w.maxFields))
+	}
+	if w.position == DelimiterPrefix {
+		w.buf.WriteByte(w.fieldDelimiter)
+	}
+	w.fieldStart = w.buf.Len()
+}
+
+// Ends a field by writing the field delimiter if it's a suffix.
+func (w *RowWriter) endField() {
+	if w.debugAssert {
+		w.assertEscaped(w.buf.Bytes()[w.fieldStart:])
+	}
+	if w.position == DelimiterSuffix {
+		w.buf.WriteByte(w.fieldDelimiter)
+	}
+}
+
+// Writes a field or returns false if type isn't a supported. Types without a
+// dedicated case are written using reflection: slices as arrays, maps as maps,
+// and structs as structs of their exported fields. nil and typed nils of any
+// type are written as NULL. When built with the protobuf tag, messages
+// generated by protoc-gen-go are written as one column per field, as a
+// HiveRow is. A driver.Valuer whose Value fails is written as NULL and the
+// error is returned by Err.
 func (w *RowWriter) WriteField(raw interface{}) bool {
+	if protoWriter != nil && protoWriter(w, raw) {
+		return true
+	}
+	if raw != nil && isNil(reflect.ValueOf(raw)) {
+		// Typed nils such as a nil *int or []string are NULL.
+		w.WriteNull()
+		return true
+	}
 	switch v := raw.(type) {
+	case omitType:
+	case nullType:
+		w.WriteNull()
 	case string:
 		w.WriteString(v)
 	case int:
 		w.WriteInt(v)
-	case int32, int64, uint, uint32, uint64:
-		w.WriteString(fmt.Sprintf("%d", v))
-	case float32, float64:
-		w.WriteString(fmt.Sprintf("%f", v))
+	case int32:
+		w.beginField()
+		w.writeInt(int64(v))
+		w.endField()
+	case int64:
+		w.beginField()
+		w.writeInt(v)
+		w.endField()
+	case uint:
+		w.beginField()
+		w.writeUint(uint64(v))
+		w.endField()
+	case uint32:
+		w.beginField()
+		w.writeUint(uint64(v))
+		w.endField()
+	case uint64:
+		w.beginField()
+		w.writeUint(v)
+		w.endField()
+	case float32:
+		w.beginField()
+		w.writeFloat(float64(v), 32, 0)
+		w.endField()
+	case float64:
+		w.WriteFloat(v)
 	case bool:
 		w.WriteBool(v)
+	case *bool:
+		w.WriteBoolPtr(v)
+	case json.RawMessage:
+		w.WriteString(string(v))
+	case []json.RawMessage:
+		w.WriteJSONArray(v)
+	case RawBytes:
+		w.WriteRawField(v)
+	case []byte:
+		w.WriteBytes(v)
 	case []string:
 		w.WriteStrArray(v)
 	case map[string]int:
 		w.WriteStrIntMap(v)
 	case map[string]uint64:
 		w.WriteStrUintMap(v)
+	case map[string]string:
+		w.WriteStrStrMap(v)
 	case time.Time:
 		w.WriteTimestamp(v)
+	case *big.Rat:
+		w.WriteRatString(v)
 	case nil:
 		w.WriteNull()
+	case nullable:
+		value, valid := v.nullableValue()
+		if !valid {
+			w.WriteNull()
+			return true
+		}
+		return w.WriteField(value)
+	case OrderedMap:
+		return w.writeReflect(v)
+	case HiveRow:
+		if err := v.WriteHiveRow(w); err != nil {
+			w.setErr(err)
+		}
+	case driver.Valuer:
+		dv, err := v.Value()
+		if err != nil {
+			// Keep the row's width so later fields stay in their columns
+			w.setErr(err)
+			w.WriteNull()
+			return true
+		}
+		return w.WriteField(dv)
+	case io.Reader:
+		w.WriteFieldFromReader(v)
 	default:
-		return false
+		return w.writeReflect(raw)
 	}
 	return true
 }
 
+// Writes a protobuf message as a row's columns, returning false for other
+// values. Only set when built with the protobuf tag.
+var protoWriter func(w *RowWriter, v interface{}) bool
+
+// Returned when a value can't be written because its type, or the type of
+// something nested within it, isn't supported.
+type UnsupportedTypeError struct {
+	Type reflect.Type // type of the value passed to WriteFieldErr
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return fmt.Sprintf("Unsupported type: %v", e.Type)
+}
+
+// Writes a field like WriteField but returns an *UnsupportedTypeError instead
+// of false if the value can't be written. Failures recorded while writing,
+// such as exceeding the maximum nesting depth, are returned instead.
+func (w *RowWriter) WriteFieldErr(v interface{}) error {
+	prev := w.err
+	if w.WriteField(v) {
+		return nil
+	}
+	if prev == nil && w.err != nil {
+		return w.err
+	}
+	return &UnsupportedTypeError{Type: reflect.TypeOf(v)}
+}
+
+// Returns the escaped serialization of a single value as WriteField would
+// write it, but without a field delimiter, so callers can assemble rows
+// themselves or hash fields. The current row is not modified. Returns an
+// error for values written as several fields, such as a HiveRow.
+func (w *RowWriter) FieldBytes(v interface{}) ([]byte, error) {
+	if w.fieldBuf == nil {
+		w.fieldBuf = bytes.NewBuffer(nil)
+	}
+	buf, pos, fields := w.buf, w.position, w.fields
+	w.buf, w.position = w.fieldBuf, delimiterNone
+	defer func() {
+		w.buf, w.position, w.fields = buf, pos, fields
+	}()
+
+	w.fieldBuf.Reset()
+	if !w.WriteField(v) {
+		return nil, &UnsupportedTypeError{Type: reflect.TypeOf(v)}
+	}
+	if n := w.fields - fields; n > 1 {
+		return nil, fmt.Errorf("%T is written as %d fields, not one", v, n)
+	}
+	out := make([]byte, w.fieldBuf.Len())
+	copy(out, w.fieldBuf.Bytes())
+	return out, nil
+}
+
+// Writes v and its field delimiter to buf as WriteField would write it to the
+// current row, for assembling rows in buffers managed by the caller. The
+// current row is not modified, though per-column settings apply as if v were
+// its next field. Returns an *UnsupportedTypeError if v can't be written, or
+// any error recorded while writing it. Values written as several fields, such
+// as a HiveRow, are an error, and buf is left as it was.
+func (w *RowWriter) WriteFieldTo(buf *bytes.Buffer, v interface{}) error {
+	rowBuf, fields, rowErr, nulls := w.buf, w.fields, w.err, len(w.rowNulls)
+	w.buf, w.err = buf, nil
+	defer func() {
+		// buf isn't a row this writer finishes, so its NULLs aren't counted
+		w.buf, w.fields, w.err, w.rowNulls = rowBuf, fields, rowErr, w.rowNulls[:nulls]
+	}()
+	start := buf.Len()
+	if err := w.WriteFieldErr(v); err != nil {
+		return err
+	}
+	if n := w.fields - fields; n > 1 {
+		buf.Truncate(start)
+		return fmt.Errorf("%T is written as %d fields, not one", v, n)
+	}
+	return w.err
+}
+
 // Write a boolean field.
 func (w *RowWriter) WriteBool(v bool) {
+	w.beginField()
 	if v {
 		w.buf.WriteString("TRUE")
 	} else {
 		w.buf.WriteString("FALSE")
 	}
-	w.buf.WriteByte(w.fieldDelimiter)
+	w.endField()
+}
+
+// Write a nullable boolean field: NULL if v is nil so an unknown value
+// isn't conflated with FALSE.
+func (w *RowWriter) WriteBoolPtr(v *bool) {
+	if v == nil {
+		w.WriteNull()
+		return
+	}
+	w.WriteBool(*v)
 }
 
 // Write an integer field.
 func (w *RowWriter) WriteInt(v int) {
-	w.buf.WriteString(strconv.Itoa(v))
-	w.buf.WriteByte(w.fieldDelimiter)
+	w.beginField()
+	w.writeInt(int64(v))
+	w.endField()
+}
+
+// Write an integer field left-padded with zeros to at least width digits,
+// such as 00042, for STRING columns of numeric IDs. Negative values have the
+// sign before the padding (-0042) which isn't counted as a digit.
+func (w *RowWriter) WriteIntPadded(v int, width int) {
+	w.beginField()
+	u := uint64(v)
+	if v < 0 {
+		w.buf.WriteByte('-')
+		u = -u
+	}
+	w.scratch = strconv.AppendUint(w.scratch[:0], u, 10)
+	for i := len(w.scratch); i < width; i++ {
+		w.buf.WriteByte('0')
+	}
+	w.buf.Write(w.scratch)
+	w.endField()
+}
+
+// Write a fixed-point decimal field from an amount in minor units such as
+// cents, avoiding float imprecision for currency: 12345 with 2 decimals is
+// written as 123.45 and 5 as 0.05. decimals of 0 or less writes an integer.
+func (w *RowWriter) WriteMoney(minorUnits int64, decimals int) {
+	w.beginField()
+	u := uint64(minorUnits)
+	if minorUnits < 0 {
+		w.buf.WriteByte('-')
+		u = -u
+	}
+	w.scratch = strconv.AppendUint(w.scratch[:0], u, 10)
+	if decimals <= 0 {
+		w.buf.Write(w.scratch)
+		w.endField()
+		return
+	}
+	digits := w.scratch
+	if len(digits) <= decimals {
+		w.buf.WriteByte('0')
+	} else {
+		w.buf.Write(digits[:len(digits)-decimals])
+		digits = digits[len(digits)-decimals:]
+	}
+	w.buf.WriteByte('.')
+	for i := len(digits); i < decimals; i++ {
+		w.buf.WriteByte('0')
+	}
+	w.buf.Write(digits)
+	w.endField()
+}
+
+// Formats an integer into the buffer via the scratch buffer without
+// allocating.
+func (w *RowWriter) writeInt(v int64) {
+	w.scratch = strconv.AppendInt(w.scratch[:0], v, 10)
+	w.buf.Write(w.scratch)
+}
+
+// Formats an unsigned integer like writeInt.
+func (w *RowWriter) writeUint(v uint64) {
+	w.scratch = strconv.AppendUint(w.scratch[:0], v, 10)
+	w.buf.Write(w.scratch)
+}
+
+// Write a float field.
+func (w *RowWriter) WriteFloat(v float64) {
+	w.beginField()
+	w.writeFloat(v, 64, 0)
+	w.endField()
+}
+
+// Sets the tokens written for positive infinity, negative infinity, and NaN
+// float values, such as "Infinity", or `\N` for NULL. By default all three
+// are written as the null token for the nesting level (see SetNullString and
+// SetCollectionNullString) as that's safest for Hive. Tokens are not escaped.
+func (w *RowWriter) SetInfNaNStrings(posInf, negInf, nan string) {
+	w.infNaN = &[3]string{posInf, negInf, nan}
+}
+
+// Formats a float directly into the buffer. bits is 32 or 64 and level is the
+// nesting level used for infinity and NaN null tokens.
+func (w *RowWriter) writeFloat(v float64, bits int, level int) {
+	special := -1
+	switch {
+	case math.IsInf(v, 1):
+		special = 0
+	case math.IsInf(v, -1):
+		special = 1
+	case math.IsNaN(v):
+		special = 2
+	}
+	if special >= 0 {
+		if w.infNaN == nil {
+			w.writeNullToken(level)
+		} else {
+			w.buf.WriteString(w.infNaN[special])
+		}
+		return
+	}
+	w.scratch = strconv.AppendFloat(w.scratch[:0], v, 'f', 6, bits)
+	w.buf.Write(w.scratch)
 }
 
 // Writes a properly escaped string field.
 func (w *RowWriter) WriteString(v string) {
+	w.beginField()
+	w.writeStringValue(v)
+	w.endField()
+}
+
+// Writes the contents of r as an escaped string field, streaming it in chunks
+// rather than reading it into memory first. The contents are read into memory
+// if a Unicode normalization or field transform is set, as those apply to the
+// whole string. A read error is returned and recorded (see Err); whatever was
+// read before the error is still written.
+func (w *RowWriter) WriteFieldFromReader(r io.Reader) error {
+	w.beginField()
+	defer w.endField()
+	whole := w.normalizer != nil || w.transform != nil
+	var all []byte
+	chunk := make([]byte, 32*1024)
+	carry := 0 // bytes of an incomplete rune kept at the start of chunk
+	for {
+		n, err := r.Read(chunk[carry:])
+		n += carry
+		carry = 0
+		if err == nil {
+			// Runes split across reads are completed by the next chunk
+			carry = incompleteRune(chunk[:n])
+		}
+		if whole {
+			all = append(all, chunk[:n-carry]...)
+		} else if n > carry {
+			w.writeStringValue(string(chunk[:n-carry]))
+		}
+		copy(chunk, chunk[n-carry:n])
+		if err == nil {
+			continue
+		}
+		if whole {
+			w.writeStringValue(string(all))
+		}
+		if err == io.EOF {
+			return nil
+		}
+		err = fmt.Errorf("Error reading field: %w", err)
+		w.setErr(err)
+		return err
+	}
+}
+
+// Returns the length of the incomplete UTF-8 sequence at the end of b, if any.
+func incompleteRune(b []byte) int {
+	for i := 1; i < utf8.UTFMax && i <= len(b); i++ {
+		if utf8.RuneStart(b[len(b)-i]) {
+			if utf8.FullRune(b[len(b)-i:]) {
+				return 0
+			}
+			return i
+		}
+	}
+	return 0
+}
+
+// Writes b verbatim as a field without any escaping. The caller is
+// responsible for ensuring it contains no delimiters.
+func (w *RowWriter) WriteRawField(b []byte) {
+	w.beginField()
+	w.buf.Write(b)
+	w.endField()
+}
+
+// Writes b as a field of raw bytes preceded by its length as an unsigned
+// varint (encoding/binary's Uvarint), for SerDes that read length-prefixed
+// binary fields. Like WriteRawField nothing is escaped, so this is only valid
+// with escaping disabled (see SetEscaping) and a reader that uses the prefix
+// rather than delimiters to find the end of the field.
+func (w *RowWriter) WriteLengthPrefixedBytes(b []byte) {
+	w.beginField()
+	w.scratch = binary.AppendUvarint(w.scratch[:0], uint64(len(b)))
+	w.buf.Write(w.scratch)
+	w.buf.Write(b)
+	w.endField()
+}
+
+// Writes a string value, as opposed to a string representation of another
+// type such as a timestamp, applying the field transform if set.
+func (w *RowWriter) writeStringValue(v string) {
+	if w.normalizer != nil {
+		v = w.normalizer.String(v)
+	}
+	if w.transform != nil {
+		v = w.transform(w.fields-1, v)
+	}
 	w.writeString(v)
-	w.buf.WriteByte(w.fieldDelimiter)
+}
+
+// Normalizes Unicode strings. Implemented by the forms in
+// golang.org/x/text/unicode/norm such as norm.NFC.
+type Normalizer interface {
+	String(s string) string
+}
+
+// Sets the Unicode normalization form applied to string values before
+// they're escaped, such as norm.NFC so canonically equivalent strings used as
+// join keys are stored identically. It runs before any SetFieldTransform.
+// Defaults to nil for no normalization.
+func (w *RowWriter) SetUnicodeNormalization(form Normalizer) {
+	w.normalizer = form
+}
+
+// Sets a function applied to string values before they're escaped, such as
+// for trimming whitespace or normalizing case. col is the column being
+// written, and strings within arrays and maps are transformed too. Values of
+// other types, including timestamps and binary, aren't passed to it. Pass nil
+// to remove the transform.
+func (w *RowWriter) SetFieldTransform(fn func(col int, s string) string) {
+	w.transform = fn
 }
 
 // Main logic of WriteString but doesn't write field delimiter so maps and
 // arrays can use it.
 func (w *RowWriter) writeString(v string) {
+	if (w.skipLineEnding || w.noEscape) && w.rejectLineEnding && strings.IndexByte(v, w.lineEnding) >= 0 {
+		w.setErr(fmt.Errorf("String contains the line ending %q: %q", w.lineEnding, v))
+	}
+	if w.noEscape {
+		w.writeEncoded(v)
+		return
+	}
 	// Write string after replacing delimiters with their escaped form.
-	w.buf.WriteString(w.replacer.Replace(v))
+	w.writeEncoded(w.replacer.Replace(v))
+}
+
+// Sets whether []byte values that are valid UTF-8 are written as strings
+// instead of being base64 encoded. Defaults to false.
+func (w *RowWriter) SetBytesAsString(enabled bool) {
+	w.bytesAsString = enabled
+}
+
+// Write a []byte as a Hive BINARY field (base64 encoded). A nil slice is
+// written as NULL.
+func (w *RowWriter) WriteBytes(v []byte) {
+	if v == nil {
+		w.WriteNull()
+		return
+	}
+	w.beginField()
+	w.writeBytes(v)
+	w.endField()
+}
+
+// Sets the encoding used for []byte fields. Defaults to Base64Encoding, which
+// is what Hive expects for BINARY columns.
+func (w *RowWriter) SetBinaryEncoding(enc BinaryEncoding) {
+	w.binaryEncoding = enc
+}
+
+// Sets the encoding used for []byte values in a column (0-based), overriding
+// SetBinaryEncoding.
+func (w *RowWriter) SetColumnEncoding(col int, enc BinaryEncoding) {
+	if w.columnEncodings == nil {
+		w.columnEncodings = make(map[int]BinaryEncoding)
+	}
+	w.columnEncodings[col] = enc
+}
+
+// Main logic of WriteBytes but doesn't write field delimiter.
+func (w *RowWriter) writeBytes(v []byte) {
+	if w.bytesAsString && utf8.Valid(v) {
+		w.writeString(string(v))
+		return
+	}
+	enc, ok := w.columnEncodings[w.fields-1]
+	if !ok {
+		enc = w.binaryEncoding
+	}
+	switch enc {
+	case HexEncoding:
+		w.buf.Write(hex.AppendEncode(w.buf.AvailableBuffer(), v))
+	default:
+		w.writeString(base64.StdEncoding.EncodeToString(v))
+	}
+}
+
+// Write an exact fraction as a "numerator/denominator" string field, such as
+// "22/7". Integers are written without a denominator. A nil Rat is NULL.
+func (w *RowWriter) WriteRatString(r *big.Rat) {
+	if r == nil {
+		w.WriteNull()
+		return
+	}
+	w.WriteString(r.RatString())
+}
+
+// Write a duration as a clock time, HH:MM:SS.fff, truncated to milliseconds.
+// Hours aren't wrapped at 24 so 25 hours is 25:00:00.000, and negative
+// durations are prefixed with -.
+func (w *RowWriter) WriteClockDuration(d time.Duration) {
+	w.beginField()
+	u := uint64(d)
+	if d < 0 {
+		w.buf.WriteByte('-')
+		u = -u
+	}
+	ms := u / uint64(time.Millisecond)
+	h, m, s := ms/3600000, ms/60000%60, ms/1000%60
+	w.scratch = w.scratch[:0]
+	if h < 10 {
+		w.scratch = append(w.scratch, '0')
+	}
+	w.scratch = strconv.AppendUint(w.scratch, h, 10)
+	w.scratch = append(w.scratch, ':', byte('0'+m/10), byte('0'+m%10), ':', byte('0'+s/10), byte('0'+s%10), '.')
+	f := ms % 1000
+	w.scratch = append(w.scratch, byte('0'+f/100), byte('0'+f/10%10), byte('0'+f%10))
+	w.buf.Write(w.scratch)
+	w.endField()
 }
 
 // Write a time as a Hive formatted timestamp.
 func (w *RowWriter) WriteTimestamp(v time.Time) {
-	w.writeString(v.Format(TimestampFormat))
-	w.buf.WriteByte(w.fieldDelimiter)
+	w.beginField()
+	w.writeString(w.formatTime(v))
+	w.endField()
+}
+
+// Sets whether times at midnight are written in DateFormat instead of
+// TimestampFormat, for callers storing dates in time.Time. Defaults to false
+// (always timestamps).
+func (w *RowWriter) SetAutoDateDetection(enabled bool) {
+	w.autoDate = enabled
+}
+
+// Formats a time as a timestamp, or as a date if auto date detection is
+// enabled and it has no time component.
+func (w *RowWriter) formatTime(v time.Time) string {
+	if w.autoDate && v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 && v.Nanosecond() == 0 {
+		return v.Format(DateFormat)
+	}
+	return v.Format(TimestampFormat)
+}
+
+// Sets the token written for NULL fields. Defaults to an empty field. The
+// token is written as-is without escaping, so Hive's default of `\N` may be
+// used.
+func (w *RowWriter) SetNullString(s string) {
+	w.nullString = s
+}
+
+// Sets the token written for NULL elements within arrays and maps, which Hive
+// configures separately from top-level NULLs. Defaults to the value set by
+// SetNullString. Like the top-level token it is not escaped.
+func (w *RowWriter) SetCollectionNullString(s string) {
+	w.collectionNullString = s
+	w.collectionNullSet = true
 }
 
-// Write an empty field (NULL in Hive).
+// Returns the NULL token for a nesting level: 0 for top-level fields and
+// deeper levels for collection elements.
+func (w *RowWriter) nullToken(level int) string {
+	if level > 0 && w.collectionNullSet {
+		return w.collectionNullString
+	}
+	return w.nullString
+}
+
+// Write a NULL field: the null token, empty by default.
 func (w *RowWriter) WriteNull() {
-	w.buf.WriteByte(w.fieldDelimiter)
+	w.beginField()
+	w.writeNullToken(0)
+	w.endField()
+}
+
+// Writes the NULL token for a nesting level. NULL fields, as opposed to NULLs
+// nested within collections or sub-rows, are counted for NullCounts.
+func (w *RowWriter) writeNullToken(level int) {
+	w.buf.WriteString(w.nullToken(level))
+	// FieldBytes doesn't write to the row so it isn't counted.
+	if level > 0 || w.depthOffset > 0 || w.position == delimiterNone {
+		return
+	}
+	// Counted once the row is finished, so dropped rows aren't.
+	w.rowNulls = append(w.rowNulls, w.fields-1)
+}
+
+// Returns how many times each column, by position, was written as NULL in rows
+// finished since the writer was created or ResetStats was called. Useful for
+// monitoring data quality; columns without NULLs are omitted, as are rows
+// dropped by Reset and fields written elsewhere by WriteFieldTo.
+func (w *RowWriter) NullCounts() map[int]int {
+	counts := make(map[int]int, len(w.nullCounts))
+	for col, n := range w.nullCounts {
+		counts[col] = n
+	}
+	return counts
+}
+
+// Clears the counts returned by NullCounts.
+func (w *RowWriter) ResetStats() {
+	w.nullCounts = nil
+}
+
+// Sets the maximum number of elements in an array, guarding against
+// pathologically large arrays from upstream bugs. Longer arrays are handled
+// according to SetArrayOverflowPolicy. 0, the default, is unlimited.
+func (w *RowWriter) SetMaxArrayElements(n int) {
+	w.maxArray = n
+}
+
+// Sets how arrays longer than SetMaxArrayElements allows are handled.
+func (w *RowWriter) SetArrayOverflowPolicy(p ArrayOverflowPolicy) {
+	w.arrayOverflow = p
+}
+
+// Returns how many of an array's n elements to write, or 0 and false, after
+// recording an error, if it's too long to write at all.
+func (w *RowWriter) limitArray(n int) (int, bool) {
+	if w.maxArray <= 0 || n <= w.maxArray {
+		return n, true
+	}
+	if w.arrayOverflow == ArrayOverflowTruncate {
+		return w.maxArray, true
+	}
+	w.setErr(fmt.Errorf("Array of %d elements exceeds the maximum of %d", n, w.maxArray))
+	return 0, false
+}
+
+// Returns how many of an array field's n elements to write, or 0 and false if
+// none should be written. A nil array is written as NULL, and arrays nested
+// too deeply or with too many elements record an error.
+func (w *RowWriter) arrayLen(null bool, n int) (int, bool) {
+	if null {
+		w.writeNullToken(0)
+		return 0, false
+	}
+	if _, ok := w.delimiter(1); !ok {
+		return 0, false
+	}
+	return w.limitArray(n)
+}
+
+// Writes an array field without reflection, using elem to write each element.
+// Shared by the typed array writers, which avoid the allocation of boxing the
+// slice for writeArrayField.
+func writeTypedArray[T any](w *RowWriter, array []T, elem func(T)) {
+	w.beginField()
+	n, ok := w.arrayLen(array == nil, len(array))
+	for i := 0; ok && i < n; i++ {
+		if i > 0 {
+			w.buf.WriteByte(w.itemDelimiter)
+		}
+		elem(array[i])
+	}
+	w.endField()
 }
 
 // Write a []string field.
 func (w *RowWriter) WriteStrArray(array []string) {
-	for i, item := range array {
+	writeTypedArray(w, array, w.writeStringValue)
+}
+
+// Write a []*string field, writing nil elements as the collection null token.
+func (w *RowWriter) WriteNullableStrArray(array []*string) {
+	w.writeArrayField(reflect.ValueOf(array))
+}
+
+// Write a []*int field, writing nil elements as the collection null token.
+func (w *RowWriter) WriteNullableIntArray(array []*int) {
+	w.writeArrayField(reflect.ValueOf(array))
+}
+
+// Write an n element ARRAY<STRING> field generated lazily by get, which
+// returns each element and whether it's valid. Invalid elements are written as
+// the collection null token.
+func (w *RowWriter) WriteStrArrayFunc(n int, get func(i int) (string, bool)) {
+	w.beginField()
+	n, ok := w.arrayLen(false, n)
+	for i := 0; ok && i < n; i++ {
 		if i > 0 {
 			w.buf.WriteByte(w.itemDelimiter)
 		}
-		w.writeString(item)
+		if v, ok := get(i); ok {
+			w.writeStringValue(v)
+		} else {
+			w.writeNullToken(1)
+		}
 	}
-	w.buf.WriteByte(w.fieldDelimiter)
+	w.endField()
+}
+
+// Write an ARRAY<STRING> field where each element is a JSON document,
+// without re-marshaling. Elements are escaped like any other string.
+func (w *RowWriter) WriteJSONArray(array []json.RawMessage) {
+	w.writeArrayField(reflect.ValueOf(array))
 }
 
 // Write a []int field.
 func (w *RowWriter) WriteIntArray(array []int) {
-	for i, item := range array {
-		if i > 0 {
+	writeTypedArray(w, array, func(v int) { w.writeInt(int64(v)) })
+}
+
+// Write a []float64 field.
+func (w *RowWriter) WriteFloatArray(array []float64) {
+	writeTypedArray(w, array, func(v float64) { w.writeFloat(v, 64, 1) })
+}
+
+// Sets how WriteVector handles NaN elements. Defaults to NaNWrite.
+func (w *RowWriter) SetVectorNaNPolicy(p NaNPolicy) {
+	w.vectorNaN = p
+}
+
+// Write a feature vector as an ARRAY<DOUBLE> field. Identical to
+// WriteFloatArray except NaN elements are handled according to the policy
+// set with SetVectorNaNPolicy, which is useful for sparse vectors.
+func (w *RowWriter) WriteVector(vector []float64) {
+	if w.vectorNaN != NaNSkip {
+		writeTypedArray(w, vector, func(v float64) {
+			if math.IsNaN(v) && w.vectorNaN == NaNNull {
+				w.writeNullToken(1)
+			} else {
+				w.writeFloat(v, 64, 1)
+			}
+		})
+		return
+	}
+	// Skipped elements have no delimiter
+	w.beginField()
+	n, _ := w.arrayLen(vector == nil, len(vector))
+	first := true
+	for _, item := range vector[:n] {
+		if math.IsNaN(item) {
+			continue
+		}
+		if !first {
 			w.buf.WriteByte(w.itemDelimiter)
 		}
-		w.buf.WriteString(strconv.Itoa(item))
+		first = false
+		w.writeFloat(item, 64, 1)
 	}
-	w.buf.WriteByte(w.fieldDelimiter)
+	w.endField()
+}
+
+// Write a []bool field.
+func (w *RowWriter) WriteBoolArray(array []bool) {
+	writeTypedArray(w, array, func(v bool) {
+		if v {
+			w.buf.WriteString("TRUE")
+		} else {
+			w.buf.WriteString("FALSE")
+		}
+	})
 }
 
-// Write a map[string]int field.
+// Write a map[string]int field. A nil map is written as NULL.
 func (w *RowWriter) WriteStrIntMap(m map[string]int) {
+	writeStrMap(w, m, func(v int) { w.writeInt(int64(v)) })
+}
+
+// Write a map[string]uint64 field. A nil map is written as NULL.
+func (w *RowWriter) WriteStrUintMap(m map[string]uint64) {
+	writeStrMap(w, m, w.writeUint)
+}
+
+// Write a map[string]string field. Keys and values are both escaped, so
+// either may contain delimiters. A nil map is written as NULL.
+func (w *RowWriter) WriteStrStrMap(m map[string]string) {
+	writeStrMap(w, m, w.writeStringValue)
+}
+
+// Writes a map with string keys as a field without reflection, using value to
+// write each value. Keys are sorted if SetSortMapKeys is enabled and a nil map
+// is written as NULL.
+func writeStrMap[V any](w *RowWriter, m map[string]V, value func(V)) {
+	w.beginField()
+	defer w.endField()
+	if m == nil {
+		w.writeNullToken(0)
+		return
+	}
+	if _, ok := w.delimiter(2); !ok {
+		return
+	}
 	first := true
-	for k, v := range m {
-		if first {
-			first = false
-		} else {
+	entry := func(k string, v V) {
+		if !first {
 			w.buf.WriteByte(w.itemDelimiter)
 		}
-		w.writeString(k)
+		first = false
+		w.writeStringValue(k)
 		w.buf.WriteByte(w.mapKeyDelimiter)
-		w.buf.WriteString(strconv.Itoa(v))
+		value(v)
+	}
+	if !w.sortMapKeys {
+		for k, v := range m {
+			entry(k, v)
+		}
+		return
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		entry(k, m[k])
 	}
-	w.buf.WriteByte(w.fieldDelimiter)
 }
 
-// Write a map[string]uint64 field.
-func (w *RowWriter) WriteStrUintMap(m map[string]uint64) {
-	first := true
-	for k, v := range m {
-		if first {
-			first = false
-		} else {
+// Writes the values of m in the order given by columns and returns the
+// completed row, writing NULL for missing keys. This bridges semi-structured
+// records, such as JSON decoded into a map, to text output. Decode JSON with
+// json.Decoder.UseNumber to keep integers from being written as floats.
+func (w *RowWriter) WriteRowFromMap(m map[string]interface{}, columns []string) ([]byte, error) {
+	for _, col := range columns {
+		v, ok := m[col]
+		if !ok {
+			w.WriteNull()
+			continue
+		}
+		if !w.WriteField(v) {
+			w.Reset()
+			return nil, fmt.Errorf("Unsupported type for column %q: %T", col, v)
+		}
+	}
+	if err := w.Err(); err != nil {
+		w.Reset()
+		return nil, err
+	}
+	return w.Row(), nil
+}
+
+// Writes each exported field of a struct, or a pointer to one, as a field,
+// such as for rows built from a TableBuilder. Fields are written in column
+// order, using their `hive:"N"` tags as DecodeRow does and skipping those
+// tagged `hive:"-"`. Returns an error, without writing anything or recording
+// it for the row, if v isn't a struct or one of its fields can't be written.
+func (w *RowWriter) WriteStruct(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("Not a struct: %T", v)
+	}
+	t := rv.Type()
+	order, err := columnFields(t)
+	if err != nil {
+		return err
+	}
+	start, fields, rowErr, nulls := w.buf.Len(), w.fields, w.err, len(w.rowNulls)
+	for _, i := range order {
+		err := w.WriteFieldErr(rv.Field(i).Interface())
+		if err == nil && rowErr == nil {
+			// Such as from a driver.Valuer
+			err = w.err
+		}
+		if err != nil {
+			w.buf.Truncate(start)
+			w.fields, w.err, w.rowNulls = fields, rowErr, w.rowNulls[:nulls]
+			return fmt.Errorf("Field %s: %v", t.Field(i).Name, err)
+		}
+	}
+	return nil
+}
+
+// Writes fields with a temporary RowWriter using delims and returns the
+// completed row, for one-off rows that don't warrant managing a writer.
+// Fields are written with WriteField, so escaping and type handling match.
+func FormatRow(delims Delimiters, fields ...interface{}) ([]byte, error) {
+	w := NewRowWriter()
+	if err := w.SetDelimiters(delims.Field, delims.Item, delims.MapKey, delims.Line); err != nil {
+		return nil, err
+	}
+	for i, f := range fields {
+		if !w.WriteField(f) {
+			return nil, fmt.Errorf("Unsupported type for field %d: %T", i, f)
+		}
+	}
+	if err := w.Err(); err != nil {
+		return nil, err
+	}
+	return w.Row(), nil
+}
+
+// Writes tag as the first field followed by fields and returns the completed
+// row, for files that interleave record types distinguished by a leading
+// type column. On error the row is dropped.
+func (w *RowWriter) WriteTaggedRow(tag string, fields ...interface{}) ([]byte, error) {
+	w.WriteString(tag)
+	for i, f := range fields {
+		if !w.WriteField(f) {
+			w.Reset()
+			return nil, fmt.Errorf("Unsupported type for field %d: %T", i+1, f)
+		}
+	}
+	if err := w.Err(); err != nil {
+		w.Reset()
+		return nil, err
+	}
+	return w.Row(), nil
+}
+
+// Writes each column as an escaped string field and returns the completed
+// row. Equivalent to calling WriteString for each column followed by Row, but
+// the row is escaped straight into the returned slice.
+func (w *RowWriter) WriteStringRow(cols []string) []byte {
+	size := w.buf.Len() + len(cols) + 1
+	for _, col := range cols {
+		size += len(col)
+	}
+	rowBuf := w.buf
+	w.stringRow = *bytes.NewBuffer(make([]byte, 0, size))
+	w.buf = &w.stringRow
+	w.buf.Write(rowBuf.Bytes())
+
+	switch {
+	case w.maxFields > 0 || w.debugAssert:
+		// Checked per field
+		for _, col := range cols {
+			w.beginField()
+			w.writeStringValue(col)
+			w.endField()
+		}
+	case w.position == DelimiterSuffix:
+		for _, col := range cols {
+			w.fields++
+			w.writeStringValue(col)
+			w.buf.WriteByte(w.fieldDelimiter)
+		}
+	case w.position == DelimiterPrefix:
+		for _, col := range cols {
+			w.fields++
+			w.buf.WriteByte(w.fieldDelimiter)
+			w.writeStringValue(col)
+		}
+	default:
+		for _, col := range cols {
+			w.fields++
+			w.writeStringValue(col)
+		}
+	}
+
+	row := w.finishRow()
+	w.observeRow(row)
+	w.buf, w.stringRow = rowBuf, bytes.Buffer{}
+	w.clearRow()
+	return row
+}
+
+// Sets whether map keys are written in sorted order (chronological for
+// time.Time keys) for deterministic output. Defaults to false, which writes
+// maps in Go's random iteration order.
+func (w *RowWriter) SetSortMapKeys(enabled bool) {
+	w.sortMapKeys = enabled
+}
+
+// Write a map[string]string field from ordered pairs of keys and values,
+// emitting them in the given order. Returns an error, without writing
+// anything, if keys and values differ in length.
+func (w *RowWriter) WriteOrderedStrMap(keys []string, values []string) error {
+	if len(keys) != len(values) {
+		return fmt.Errorf("Mismatched map: %d keys but %d values", len(keys), len(values))
+	}
+	w.beginField()
+	for i, k := range keys {
+		if i > 0 {
 			w.buf.WriteByte(w.itemDelimiter)
 		}
-		w.writeString(k)
+		w.writeStringValue(k)
 		w.buf.WriteByte(w.mapKeyDelimiter)
-		w.buf.WriteString(strconv.FormatUint(v, 10))
+		w.writeStringValue(values[i])
+	}
+	w.endField()
+	return nil
+}
+
+// Returns the first error encountered while writing the current row, such as
+// an error returned by a driver.Valuer. Check Err before calling Row as both
+// Row and Reset clear it.
+func (w *RowWriter) Err() error {
+	return w.err
+}
+
+// Records an error for the current row unless one was already recorded.
+func (w *RowWriter) setErr(err error) {
+	if w.err == nil {
+		w.err = err
 	}
-	w.buf.WriteByte(w.fieldDelimiter)
 }
 
 // Returns the current row and resets the internal buffer for the next row.
 func (w *RowWriter) Row() []byte {
-	w.buf.WriteByte(w.lineEnding)
-	buf := make([]byte, w.buf.Len())
-	w.buf.Read(buf)
+	row := w.finishRow()
+	w.observeRow(row)
+	buf := make([]byte, len(row))
+	copy(buf, row)
+	w.clearRow()
 	return buf
 }
 
 // Drop the current row (resets the internal row buffer).
 func (w *RowWriter) Reset() {
+	if w.onReset != nil && w.buf.Len() > 0 {
+		w.onReset(w.buf.Bytes())
+	}
+	w.clearRow()
+}
+
+// Sets a callback invoked by Reset with the partial row being dropped, such as
+// for routing malformed rows to a dead-letter queue. It isn't called when
+// there's nothing to drop. partial is only valid until the callback returns.
+// Pass nil to remove the callback.
+func (w *RowWriter) OnReset(fn func(partial []byte)) {
+	w.onReset = fn
+}
+
+// Ends the current row and returns it without copying. The returned slice is
+// only valid until clearRow is called. Callers pass rows they emit to
+// observeRow.
+func (w *RowWriter) finishRow() []byte {
+	if len(w.rowNulls) > 0 && w.nullCounts == nil {
+		w.nullCounts = make(map[int]int)
+	}
+	for _, col := range w.rowNulls {
+		w.nullCounts[col]++
+	}
+	w.rowNulls = w.rowNulls[:0]
+	w.buf.WriteByte(w.lineEnding)
+	return w.buf.Bytes()
+}
+
+// Reports a completed row to the record size observer, if any.
+func (w *RowWriter) observeRow(row []byte) {
+	if w.sizeObserver != nil {
+		w.sizeObserver(len(row))
+	}
+}
+
+// Sets a function called with the size in bytes, including the line ending,
+// of each completed row, such as for building a histogram of row sizes to
+// tune block sizes and compression. Rows a StreamWriter drops as duplicates
+// aren't reported. Pass nil to remove it.
+func (w *RowWriter) SetRecordSizeObserver(fn func(size int)) {
+	w.sizeObserver = fn
+}
+
+// Empties the row buffer and clears per-row state.
+func (w *RowWriter) clearRow() {
 	w.buf.Reset()
+	w.err = nil
+	w.fields = 0
+	w.rowNulls = w.rowNulls[:0]
 }
@@ -2,7 +2,16 @@ package hadoopfiles
 
 import (
 	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 )
 
@@ -80,3 +89,1230 @@ func TestRowWriterDelimiters(t *testing.T) {
 		}
 	}
 }
+
+func TestWriteClockDuration(t *testing.T) {
+	f := NewRowWriter()
+	for _, c := range []struct {
+		d        time.Duration
+		expected string
+	}{
+		{0, "00:00:00.000"},
+		{1500*time.Millisecond + 999*time.Microsecond, "00:00:01.500"},
+		{42 * time.Millisecond, "00:00:00.042"},
+		{3*time.Hour + 4*time.Minute + 5*time.Second, "03:04:05.000"},
+		{25 * time.Hour, "25:00:00.000"},
+		{123*time.Hour + 59*time.Minute + 59*time.Second + 999*time.Millisecond, "123:59:59.999"},
+		{-90 * time.Second, "-00:01:30.000"},
+	} {
+		f.WriteClockDuration(c.d)
+		if out := f.Row(); string(out) != c.expected+"\x01\n" {
+			t.Errorf("WriteClockDuration(%v) = %q; expected %q", c.d, out, c.expected)
+		}
+	}
+}
+
+func TestWriteFieldTo(t *testing.T) {
+	fields := []interface{}{"a\x01b", 42, []string{"c", "d"}, nil}
+	f := NewRowWriter()
+	f.WriteString("pending")
+
+	var buf bytes.Buffer
+	for _, v := range fields {
+		if err := f.WriteFieldTo(&buf, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.WriteFieldTo(&buf, make(chan int)); err == nil {
+		t.Error("Expected an error for an unsupported type")
+	}
+	if out := f.Row(); string(out) != "pending\x01\n" {
+		t.Errorf("Current row was modified: %q", out)
+	}
+
+	for _, v := range fields {
+		f.WriteField(v)
+	}
+	expected := f.Row()
+	buf.WriteByte('\n')
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, buf.Bytes())
+	}
+}
+
+func TestWriteTaggedRow(t *testing.T) {
+	f := NewRowWriter()
+	click, err := f.WriteTaggedRow("click", 1, "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	view, err := f.WriteTaggedRow("view\x01", []string{"x", "y"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cols := f.DebugColumns(click); len(cols) != 3 || cols[0] != "click" {
+		t.Errorf("Unexpected columns: %q", cols)
+	}
+	if expected := "view\\x01\x01x\x02y\x01\n"; string(view) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, view)
+	}
+
+	if _, err := f.WriteTaggedRow("bad", 1, make(chan int)); err == nil || !strings.Contains(err.Error(), "field 2") {
+		t.Errorf("Expected an unsupported type error for field 2 but found: %v", err)
+	}
+}
+
+func TestWriteStringRow(t *testing.T) {
+	f := NewRowWriter()
+	cols := []string{"a", "b\x01c", "", "d\\"}
+	for _, col := range cols {
+		f.WriteString(col)
+	}
+	expected := f.Row()
+
+	out := f.WriteStringRow(cols)
+	if !bytes.Equal(out, expected) {
+		t.Fatalf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+	if string(out) != "a\x01b\\x01c\x01\x01d\\\\\x01\n" {
+		t.Errorf("Unexpected row: %q", out)
+	}
+
+	// Fields already written start the row
+	f.WriteInt(1)
+	if out, expected := f.WriteStringRow(cols[:2]), "1\x01a\x01b\\x01c\x01\n"; string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+
+	f = NewRowWriter()
+	if err := f.SetDelimiterPosition(DelimiterPrefix); err != nil {
+		t.Fatal(err)
+	}
+	if out, expected := f.WriteStringRow(cols[:2]), "\x01a\x01b\\x01c\n"; string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+}
+
+func TestFormatRow(t *testing.T) {
+	delims := Delimiters{Field: '|', Item: ',', MapKey: ':', Line: '\n'}
+	fields := []interface{}{"a|b", 1, []string{"x", "y,z"}, nil, true}
+
+	f := NewRowWriter()
+	if err := f.SetDelimiters('|', ',', ':', '\n'); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range fields {
+		f.WriteField(v)
+	}
+	expected := f.Row()
+
+	out, err := FormatRow(delims, fields...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, expected) {
+		t.Fatalf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+	if string(out) != "a\\|b|1|x,y\\,z||TRUE|\n" {
+		t.Errorf("Unexpected row: %q", out)
+	}
+
+	if _, err := FormatRow(DefaultDelimiters, "a", make(chan int)); err == nil {
+		t.Error("Expected an error for an unsupported type")
+	}
+	if _, err := FormatRow(Delimiters{Field: 'a', Item: ',', MapKey: ':', Line: '\n'}); err == nil {
+		t.Error("Expected an error for invalid delimiters")
+	}
+}
+
+var benchCols = []string{"2014-01-30", "user-1234", "GET", "/index.html", "200", "Mozilla/5.0"}
+
+func BenchmarkWriteString(b *testing.B) {
+	f := NewRowWriter()
+	for i := 0; i < b.N; i++ {
+		for _, col := range benchCols {
+			f.WriteString(col)
+		}
+		f.Row()
+	}
+}
+
+func BenchmarkWriteStringRow(b *testing.B) {
+	f := NewRowWriter()
+	for i := 0; i < b.N; i++ {
+		f.WriteStringRow(benchCols)
+	}
+}
+
+func TestRowWriterDelimiterPosition(t *testing.T) {
+	f := NewRowWriter()
+	f.WriteString("a")
+	if err := f.SetDelimiterPosition(DelimiterPrefix); err == nil {
+		t.Error("SetDelimiterPosition should fail after starting a row")
+	}
+	f.Reset()
+
+	for _, c := range []struct {
+		pos      DelimiterPosition
+		expected string
+	}{
+		{DelimiterPrefix, "\x01a\x0142\n"},
+		{DelimiterSuffix, "a\x0142\x01\n"},
+	} {
+		if err := f.SetDelimiterPosition(c.pos); err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString("a")
+		f.WriteField(42)
+		out := f.Row()
+		if string(out) != c.expected {
+			t.Errorf("Expected: %q !=\nActual:  %q", c.expected, out)
+		}
+	}
+}
+
+func TestFieldBytes(t *testing.T) {
+	f := NewRowWriter()
+	f.WriteString("before")
+
+	for _, c := range []struct {
+		v        interface{}
+		expected string
+	}{
+		{"a\x01b\x02c\\", "a\\x01b\\x02c\\\\"},
+		{42, "42"},
+	} {
+		out, err := f.FieldBytes(c.v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != c.expected {
+			t.Errorf("Expected: %q !=\nActual:  %q", c.expected, out)
+		}
+	}
+
+	if _, err := f.FieldBytes(make(chan int)); err == nil {
+		t.Error("FieldBytes should fail on a chan")
+	}
+
+	if out := f.Row(); string(out) != "before\x01\n" {
+		t.Errorf("FieldBytes modified the current row: %q", out)
+	}
+}
+
+func TestRowWriterNullStrings(t *testing.T) {
+	a, c := "a", "c"
+	f := NewRowWriter()
+
+	// Both default to an empty field
+	{
+		expected := []byte("\x01a\x02\x02c\x01\n")
+		f.WriteNull()
+		f.WriteNullableStrArray([]*string{&a, nil, &c})
+		out := f.Row()
+		if !bytes.Equal(out, expected) {
+			t.Fatalf("Expected: %q !=\nActual:  %q", expected, out)
+		}
+	}
+
+	// Collections follow the field null token until set separately
+	f.SetNullString(`\N`)
+	{
+		expected := []byte("\\N\x01a\x02\\N\x01\n")
+		f.WriteField(nil)
+		f.WriteNullableStrArray([]*string{&a, nil})
+		out := f.Row()
+		if !bytes.Equal(out, expected) {
+			t.Fatalf("Expected: %q !=\nActual:  %q", expected, out)
+		}
+	}
+
+	f.SetCollectionNullString("null")
+	{
+		one := 1
+		expected := []byte("\\N\x01a\x02null\x02c\x011\x02null\x01x\x03null\x01\n")
+		f.WriteNull()
+		f.WriteNullableStrArray([]*string{&a, nil, &c})
+		f.WriteNullableIntArray([]*int{&one, nil})
+		f.WriteField(map[string]*int{"x": nil})
+		out := f.Row()
+		if !bytes.Equal(out, expected) {
+			t.Fatalf("Expected: %q !=\nActual:  %q", expected, out)
+		}
+	}
+}
+
+func TestWriteBoolPtr(t *testing.T) {
+	yes, no := true, false
+	var unknown *bool
+	f := NewRowWriter()
+	f.SetNullString(`\N`)
+	f.WriteBoolPtr(&yes)
+	f.WriteBoolPtr(&no)
+	f.WriteBoolPtr(nil)
+	f.WriteField(&yes)
+	f.WriteField(&no)
+	f.WriteField(unknown)
+	expected := "TRUE\x01FALSE\x01\\N\x01TRUE\x01FALSE\x01\\N\x01\n"
+	if out := f.Row(); string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+}
+
+func TestSetMaxArrayElements(t *testing.T) {
+	big := []int{1, 2, 3, 4}
+	f := NewRowWriter()
+	f.SetMaxArrayElements(3)
+	f.WriteIntArray([]int{1, 2, 3})
+	if err := f.Err(); err != nil {
+		t.Fatalf("Arrays at the limit should be written: %v", err)
+	}
+	f.Reset()
+
+	f.WriteIntArray(big)
+	if err := f.Err(); err == nil || !strings.Contains(err.Error(), "4 elements exceeds the maximum of 3") {
+		t.Errorf("Expected an overflow error but found: %v", err)
+	}
+	f.Reset()
+	if f.WriteField([][]int{{1}, big}) {
+		t.Error("WriteField should fail on nested oversized arrays")
+	}
+	f.Reset()
+
+	f.SetArrayOverflowPolicy(ArrayOverflowTruncate)
+	f.WriteIntArray(big)
+	f.WriteField([][]int{big})
+	f.WriteStrArrayFunc(5, func(i int) (string, bool) { return strconv.Itoa(i), true })
+	f.WriteVector([]float64{1, 2, 3, 4})
+	if err := f.Err(); err != nil {
+		t.Fatal(err)
+	}
+	expected := "1\x022\x023\x01" + "1\x032\x033\x01" + "0\x021\x022\x01" +
+		"1.000000\x022.000000\x023.000000\x01\n"
+	if out := f.Row(); string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+}
+
+func TestWriteIntOutput(t *testing.T) {
+	f := NewRowWriter()
+	ints := []int{0, 1, -1, 42, -9001, math.MaxInt64, math.MinInt64}
+	for _, v := range ints {
+		f.WriteInt(v)
+		expected := strconv.Itoa(v) + "\x01\n"
+		if out := f.Row(); string(out) != expected {
+			t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+		}
+	}
+
+	f.WriteIntArray(ints)
+	expected := "0\x021\x02-1\x0242\x02-9001\x029223372036854775807\x02-9223372036854775808\x01\n"
+	if out := f.Row(); string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		f.WriteInt(123456789)
+		f.WriteIntArray(ints)
+		f.Reset()
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocations writing ints but found %v", allocs)
+	}
+
+	for _, v := range []interface{}{int32(math.MinInt32), int64(math.MinInt64), uint(7), uint32(math.MaxUint32), uint64(math.MaxUint64)} {
+		f.WriteField(v)
+	}
+	expected = "-2147483648\x01-9223372036854775808\x017\x014294967295\x0118446744073709551615\x01\n"
+	if out := f.Row(); string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+}
+
+func TestWriteIntPadded(t *testing.T) {
+	f := NewRowWriter()
+	cases := []struct {
+		v, width int
+		expected string
+	}{
+		{42, 5, "00042"},
+		{0, 3, "000"},
+		{-42, 5, "-00042"},
+		{123456, 3, "123456"},
+		{-123456, 6, "-123456"},
+		{7, 0, "7"},
+		{math.MinInt64, 20, "-09223372036854775808"},
+	}
+	for _, c := range cases {
+		f.WriteIntPadded(c.v, c.width)
+		if out := f.Row(); string(out) != c.expected+"\x01\n" {
+			t.Errorf("WriteIntPadded(%d, %d) = %q; expected %q", c.v, c.width, out, c.expected)
+		}
+	}
+}
+
+func TestWriteMoney(t *testing.T) {
+	f := NewRowWriter()
+	cases := []struct {
+		v        int64
+		decimals int
+		expected string
+	}{
+		{12345, 2, "123.45"},
+		{-12345, 2, "-123.45"},
+		{5, 2, "0.05"},
+		{-5, 2, "-0.05"},
+		{0, 2, "0.00"},
+		{100, 2, "1.00"},
+		{42, 3, "0.042"},
+		{42, 0, "42"},
+		{math.MinInt64, 4, "-922337203685477.5808"},
+	}
+	for _, c := range cases {
+		f.WriteMoney(c.v, c.decimals)
+		if out := f.Row(); string(out) != c.expected+"\x01\n" {
+			t.Errorf("WriteMoney(%d, %d) = %q; expected %q", c.v, c.decimals, out, c.expected)
+		}
+	}
+}
+
+func BenchmarkWriteInt(b *testing.B) {
+	f := NewRowWriter()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		f.WriteInt(i)
+		f.Reset()
+	}
+}
+
+func BenchmarkWriteIntArray(b *testing.B) {
+	f := NewRowWriter()
+	array := []int{1, 22, 333, 4444, 55555, 666666, 7777777}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		f.WriteIntArray(array)
+		f.Reset()
+	}
+}
+
+type testValuer struct {
+	s   string
+	err error
+}
+
+func (v testValuer) Value() (driver.Value, error) {
+	return v.s, v.err
+}
+
+func TestWriteFieldValuer(t *testing.T) {
+	f := NewRowWriter()
+	{
+		expected := []byte("a\\x01b\x01\n")
+		if !f.WriteField(testValuer{s: "a\x01b"}) {
+			t.Fatal("WriteField failed on a driver.Valuer")
+		}
+		if err := f.Err(); err != nil {
+			t.Fatal(err)
+		}
+		out := f.Row()
+		if !bytes.Equal(out, expected) {
+			t.Fatalf("Expected: %q !=\nActual:  %q", expected, out)
+		}
+	}
+
+	boom := errors.New("boom")
+	f.SetNullString(`\N`)
+	f.WriteField(testValuer{err: boom})
+	f.WriteString("next")
+	if err := f.Err(); err != boom {
+		t.Fatalf("Expected Value() error but found: %v", err)
+	}
+	if out, expected := f.Row(), "\\N\x01next\x01\n"; string(out) != expected {
+		t.Errorf("Expected a NULL in the failed column: %q !=\nActual:  %q", expected, out)
+	}
+	f.WriteField(testValuer{err: boom})
+	f.Reset()
+	if err := f.Err(); err != nil {
+		t.Fatalf("Reset should clear the error but found: %v", err)
+	}
+}
+
+func TestRowWriterMaxFields(t *testing.T) {
+	f := NewRowWriter()
+	f.SetMaxFields(2)
+	f.WriteString("a")
+	f.WriteField(1)
+	if err := f.Err(); err != nil {
+		t.Fatalf("Unexpected error at the limit: %v", err)
+	}
+	f.WriteNull()
+	if err := f.Err(); err == nil {
+		t.Fatal("Expected an error after exceeding the maximum fields")
+	}
+
+	// Limit applies per row
+	f.Row()
+	f.WriteString("b")
+	f.WriteString("c")
+	if err := f.Err(); err != nil {
+		t.Fatalf("Unexpected error on new row: %v", err)
+	}
+}
+
+func TestWriteBytes(t *testing.T) {
+	text := []byte("héllo\x01")
+	binary := []byte{0xff, 0x00, 0xfe}
+
+	f := NewRowWriter()
+	{
+		expected := []byte("aMOpbGxvAQ==\x01/wD+\x01\n")
+		f.WriteField(text)
+		f.WriteBytes(binary)
+		out := f.Row()
+		if !bytes.Equal(out, expected) {
+			t.Fatalf("Expected: %q !=\nActual:  %q", expected, out)
+		}
+	}
+
+	f.SetBytesAsString(true)
+	{
+		expected := []byte("héllo\\x01\x01/wD+\x01\n")
+		f.WriteField(text)
+		f.WriteBytes(binary)
+		out := f.Row()
+		if !bytes.Equal(out, expected) {
+			t.Fatalf("Expected: %q !=\nActual:  %q", expected, out)
+		}
+	}
+}
+
+func TestWriteOrderedStrMap(t *testing.T) {
+	f := NewRowWriter()
+	expected := []byte("z\x031\x02a\x032\x02m\x03\\x03\x01\n")
+	if err := f.WriteOrderedStrMap([]string{"z", "a", "m"}, []string{"1", "2", "\x03"}); err != nil {
+		t.Fatal(err)
+	}
+	out := f.Row()
+	if !bytes.Equal(out, expected) {
+		t.Fatalf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+
+	if err := f.WriteOrderedStrMap([]string{"a"}, nil); err == nil {
+		t.Fatal("Expected an error for mismatched keys and values")
+	}
+	if out := f.Row(); !bytes.Equal(out, []byte("\n")) {
+		t.Fatalf("Nothing should be written on error: %q", out)
+	}
+}
+
+func TestWriteVector(t *testing.T) {
+	f := NewRowWriter()
+	f.SetCollectionNullString(`\N`)
+	f.SetInfNaNStrings("Infinity", "-Infinity", "NaN")
+	vector := []float64{1, math.NaN(), 0.25}
+
+	for _, c := range []struct {
+		policy   NaNPolicy
+		expected string
+	}{
+		{NaNWrite, "1.000000\x02NaN\x020.250000\x01\n"},
+		{NaNSkip, "1.000000\x020.250000\x01\n"},
+		{NaNNull, "1.000000\x02\\N\x020.250000\x01\n"},
+	} {
+		f.SetVectorNaNPolicy(c.policy)
+		f.WriteVector(vector)
+		if out := f.Row(); string(out) != c.expected {
+			t.Errorf("Expected: %q !=\nActual:  %q", c.expected, out)
+		}
+	}
+
+	// A nil vector is NULL, like a nil array, under every policy
+	f.SetNullString(`\N`)
+	for _, p := range []NaNPolicy{NaNWrite, NaNSkip, NaNNull} {
+		f.SetVectorNaNPolicy(p)
+		f.WriteVector(nil)
+		f.WriteFloatArray(nil)
+		if out, expected := f.Row(), "\\N\x01\\N\x01\n"; string(out) != expected {
+			t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+		}
+	}
+
+	f.SetMaxNestingDepth(1)
+	f.WriteVector(vector)
+	if f.Err() == nil {
+		t.Error("Expected a nesting depth error")
+	}
+}
+
+func TestResetWithDelimiters(t *testing.T) {
+	f := NewRowWriter()
+	f.WriteString("dirty")
+
+	if err := f.ResetWithDelimiters('a', ';', ':', '\n'); err == nil {
+		t.Fatal("Expected invalid delimiters to fail")
+	}
+	if f.delims != "\x01\x02\x03\n" {
+		t.Errorf("delims shouldn't have changed: %q", f.delims)
+	}
+	if f.buf.String() != "dirty\x01" {
+		t.Errorf("Row shouldn't have been reset: %q", f.buf.String())
+	}
+
+	if err := f.ResetWithDelimiters(',', ';', ':', '\n'); err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("a,b")
+	f.WriteStrArray([]string{"c", "d"})
+	expected := []byte("a\\,b,c;d,\n")
+	if out := f.Row(); !bytes.Equal(out, expected) {
+		t.Fatalf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+}
+
+func TestSetEscapeCR(t *testing.T) {
+	f := NewRowWriter()
+	f.WriteString("a\r\nb")
+	if out, expected := f.Row(), "a\r\\nb\x01\n"; string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+
+	f.SetEscapeCR(true)
+	f.WriteString("a\r\nb")
+	f.WriteStrArray([]string{"\r"})
+	if out, expected := f.Row(), "a\\r\\nb\x01\\r\x01\n"; string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+
+	// Still escaped once when \r is the line ending
+	if err := f.ResetWithDelimiters(1, 2, 3, '\r'); err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("a\rb")
+	if out, expected := f.Row(), "a\\rb\x01\r"; string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+}
+
+func TestSetRecordSizeObserver(t *testing.T) {
+	var sizes []int
+	var buf bytes.Buffer
+	s := NewStreamWriter(&buf)
+	s.SetRecordSizeObserver(func(size int) { sizes = append(sizes, size) })
+
+	s.WriteString("a")
+	s.EndRow()
+	s.WriteString("bc\x01")
+	s.WriteInt(10)
+	s.EndRow()
+	s.WriteString("dropped")
+	s.Reset()
+	s.WriteNull()
+	s.Row()
+
+	expected := []int{3, 11, 2}
+	if len(sizes) != len(expected) {
+		t.Fatalf("Expected sizes %v but found %v", expected, sizes)
+	}
+	for i := range expected {
+		if sizes[i] != expected[i] {
+			t.Errorf("Row %d: expected size %d but found %d", i, expected[i], sizes[i])
+		}
+	}
+	if buf.Len() != 14 {
+		t.Errorf("Observed sizes don't match output: %q", buf.Bytes())
+	}
+}
+
+func TestOnReset(t *testing.T) {
+	f := NewRowWriter()
+	var dropped []string
+	f.OnReset(func(partial []byte) {
+		dropped = append(dropped, string(partial))
+	})
+
+	f.WriteString("a")
+	f.WriteInt(1)
+	f.Reset()
+	f.Reset() // nothing to drop
+	f.WriteString("b")
+	f.Row() // completed rows aren't dropped
+
+	if len(dropped) != 1 || dropped[0] != "a\x011\x01" {
+		t.Fatalf("Unexpected partial rows: %q", dropped)
+	}
+
+	f.OnReset(nil)
+	f.WriteString("c")
+	f.Reset()
+	if len(dropped) != 1 {
+		t.Fatalf("Callback shouldn't be called after removal: %q", dropped)
+	}
+}
+
+func TestWriteStrMapAllocs(t *testing.T) {
+	f := NewRowWriter()
+	ints := map[string]int{"a": 1, "b": -2}
+	uints := map[string]uint64{"c": 3}
+	strs := map[string]string{"d": "e"}
+	allocs := testing.AllocsPerRun(100, func() {
+		f.WriteStrIntMap(ints)
+		f.WriteStrUintMap(uints)
+		f.WriteStrStrMap(strs)
+		f.Reset()
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocations writing typed maps but found %v", allocs)
+	}
+
+	f.SetSortMapKeys(true)
+	f.WriteStrIntMap(ints)
+	f.WriteStrStrMap(nil)
+	if out, expected := f.Row(), "a\x031\x02b\x03-2\x01\x01\n"; string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+}
+
+func TestWriteStrStrMapRoundTrip(t *testing.T) {
+	m := map[string]string{"k\x03ey": "v\x03al\x02ue", "a": "\\x03"}
+	f := NewRowWriter()
+	f.SetSortMapKeys(true)
+	f.WriteStrStrMap(m)
+	row := f.Row()
+	if expected := "a\x03\\\\x03\x02k\\x03ey\x03v\\x03al\\x02ue\x01\n"; string(row) != expected {
+		t.Fatalf("Expected: %q !=\nActual:  %q", expected, row)
+	}
+
+	// Split the row like a reader would: fields, then entries, then keys, and
+	// only then unescape.
+	raw := splitFields(bytes.TrimSuffix(row, []byte{DefaultLineEnding}), DefaultFieldDelimiter)[0]
+	decoded := map[string]string{}
+	for _, entry := range splitFields(raw, DefaultItemDelimiter) {
+		i := indexUnescaped(entry, DefaultMapKeyDelimiter)
+		if i < 0 {
+			t.Fatalf("Entry without a key delimiter: %q", entry)
+		}
+		k, err := unescape(entry[:i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := unescape(entry[i+1:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded[k] = v
+	}
+	if len(decoded) != len(m) {
+		t.Fatalf("Expected %q but read %q", m, decoded)
+	}
+	for k, v := range m {
+		if decoded[k] != v {
+			t.Errorf("Key %q: expected %q but read %q", k, v, decoded[k])
+		}
+	}
+}
+
+func TestWriteFieldOmit(t *testing.T) {
+	f := NewRowWriter()
+	f.WriteField(Omit)
+	if f.buf.Len() != 0 {
+		t.Fatalf("Omit should write nothing: %q", f.buf.Bytes())
+	}
+	f.WriteField(Null)
+	if f.buf.String() != "\x01" {
+		t.Fatalf("Null should write a delimiter: %q", f.buf.Bytes())
+	}
+	f.Reset()
+
+	f.WriteString("a")
+	f.WriteField(Omit)
+	f.WriteString("b")
+	f.WriteField(Null)
+	f.WriteString("c")
+	if out, expected := f.Row(), "a\x01b\x01\x01c\x01\n"; string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+
+	if f.WriteField([]interface{}{"a", Omit}) {
+		t.Error("Omit shouldn't be allowed within collections")
+	}
+}
+
+func TestNullCounts(t *testing.T) {
+	f := NewRowWriter()
+	var nilSlice []string
+	rows := [][]interface{}{
+		{"a", 1, nil},
+		{"b", nil, Null},
+		{"c", 2, NullableString{}},
+		{"d", 3, nilSlice},
+		{"e", 4, []interface{}{nil}}, // nested NULLs aren't counted
+	}
+	for _, row := range rows {
+		for _, v := range row {
+			f.WriteField(v)
+		}
+		f.Row()
+	}
+	f.FieldBytes(nil)
+	f.WriteFieldTo(bytes.NewBuffer(nil), nil)
+	f.WriteNull()
+	f.Reset()
+	f.WriteString("f")
+	if err := f.WriteStruct(struct {
+		A *string
+		B chan int
+	}{}); err == nil {
+		t.Fatal("Expected an error for a chan field")
+	}
+	f.Row()
+
+	counts := f.NullCounts()
+	if len(counts) != 2 || counts[1] != 1 || counts[2] != 4 {
+		t.Fatalf("Unexpected null counts: %v", counts)
+	}
+	counts[2] = 0
+	if f.NullCounts()[2] != 4 {
+		t.Error("NullCounts should return a copy")
+	}
+
+	f.ResetStats()
+	if counts := f.NullCounts(); len(counts) != 0 {
+		t.Errorf("Expected no null counts after ResetStats: %v", counts)
+	}
+}
+
+func TestWriteFieldNull(t *testing.T) {
+	f := NewRowWriter()
+	f.SetNullString(`\N`)
+	f.SetCollectionNullString("null")
+	expected := []byte("\\N\x01a\x02null\x01\n")
+	if !f.WriteField(Null) {
+		t.Fatal("WriteField failed on Null")
+	}
+	f.WriteField([]interface{}{"a", Null})
+	if out := f.Row(); !bytes.Equal(out, expected) {
+		t.Fatalf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+}
+
+type testHiveRow struct {
+	id   int
+	name string
+	tags []string
+}
+
+func (r testHiveRow) WriteHiveRow(w *RowWriter) error {
+	w.WriteInt(r.id)
+	w.WriteString(r.name)
+	w.WriteStrArray(r.tags)
+	return nil
+}
+
+func TestWriteFieldHiveRow(t *testing.T) {
+	f := NewRowWriter()
+	expected := []byte("7\x01seven\x01a\x02b\x01\n")
+	if !f.WriteField(testHiveRow{7, "seven", []string{"a", "b"}}) {
+		t.Fatal("WriteField failed on a HiveRow")
+	}
+	if out := f.Row(); !bytes.Equal(out, expected) {
+		t.Fatalf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+}
+
+func TestRowWriterInfNaN(t *testing.T) {
+	inf, ninf, nan := math.Inf(1), math.Inf(-1), math.NaN()
+	f := NewRowWriter()
+
+	// Defaults to null tokens
+	f.SetNullString(`\N`)
+	f.SetCollectionNullString("null")
+	{
+		expected := []byte("\\N\x01\\N\x01\\N\x011.500000\x02null\x01\n")
+		f.WriteFloat(inf)
+		f.WriteField(ninf)
+		f.WriteField(float32(nan))
+		f.WriteFloatArray([]float64{1.5, nan})
+		if out := f.Row(); !bytes.Equal(out, expected) {
+			t.Fatalf("Expected: %q !=\nActual:  %q", expected, out)
+		}
+	}
+
+	f.SetInfNaNStrings("Infinity", "-Infinity", "NaN")
+	{
+		expected := []byte("Infinity\x01-Infinity\x01NaN\x01Infinity\x02-Infinity\x01k\x03NaN\x01\n")
+		f.WriteFloat(inf)
+		f.WriteFloat(ninf)
+		f.WriteField(nan)
+		f.WriteFloatArray([]float64{inf, ninf})
+		f.WriteField(map[string]float64{"k": nan})
+		if out := f.Row(); !bytes.Equal(out, expected) {
+			t.Fatalf("Expected: %q !=\nActual:  %q", expected, out)
+		}
+	}
+}
+
+func TestWriteRowFromMap(t *testing.T) {
+	dec := json.NewDecoder(strings.NewReader(`{"id": 42, "name": "x\u0001y", "tags": ["a", "b"]}`))
+	dec.UseNumber()
+	var m map[string]interface{}
+	if err := dec.Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+
+	f := NewRowWriter()
+	out, err := f.WriteRowFromMap(m, []string{"id", "missing", "name", "tags"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte("42\x01\x01x\\x01y\x01a\x02b\x01\n")
+	if !bytes.Equal(out, expected) {
+		t.Fatalf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+
+	if _, err := f.WriteRowFromMap(map[string]interface{}{"c": make(chan int)}, []string{"c"}); err == nil {
+		t.Fatal("Expected an error for an unsupported value")
+	}
+}
+
+func TestWriteFieldRawBytes(t *testing.T) {
+	f := NewRowWriter()
+	f.SetBinaryEncoding(HexEncoding)
+	if !f.WriteField(RawBytes("abc")) {
+		t.Fatal("WriteField failed on RawBytes")
+	}
+	f.WriteField(RawBytes("\\x"))
+	f.WriteField([]RawBytes{RawBytes("d"), RawBytes("e")})
+	if out, expected := f.Row(), "abc\x01\\x\x01d\x02e\x01\n"; string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+}
+
+func TestWriteLengthPrefixedBytes(t *testing.T) {
+	f := NewRowWriter()
+	if err := f.SetEscaping(false); err != nil {
+		t.Fatal(err)
+	}
+	long := bytes.Repeat([]byte{0xff}, 300)
+	f.WriteLengthPrefixedBytes([]byte("a\x01\n"))
+	f.WriteLengthPrefixedBytes(nil)
+	f.WriteLengthPrefixedBytes(long)
+
+	expected := append([]byte("\x03a\x01\n\x01\x00\x01\xac\x02"), long...)
+	expected = append(expected, "\x01\n"...)
+	if out := f.Row(); !bytes.Equal(out, expected) {
+		t.Fatalf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+}
+
+func TestRowWriterDebugAssert(t *testing.T) {
+	f := NewRowWriter()
+	f.WriteRawField([]byte("a\x01b"))
+	if err := f.Err(); err != nil {
+		t.Fatalf("Assertions should be off by default: %v", err)
+	}
+	f.Reset()
+
+	f.SetDebugAssert(true)
+	f.WriteString("a\x01b\nc")
+	f.WriteStrArray([]string{"d", "e"})
+	if err := f.Err(); err != nil {
+		t.Fatalf("Unexpected assertion failure for escaped fields: %v", err)
+	}
+	f.WriteRawField([]byte("bad\nrow"))
+	if err := f.Err(); err == nil {
+		t.Fatal("Expected assertion to fire on an unescaped line ending")
+	}
+}
+
+func TestRowWriterAutoDate(t *testing.T) {
+	midnight := time.Date(2014, 1, 2, 0, 0, 0, 0, time.UTC)
+	later := time.Date(2014, 1, 2, 0, 0, 0, 1, time.UTC)
+	f := NewRowWriter()
+
+	f.WriteTimestamp(midnight)
+	if out, expected := f.Row(), "2014-01-02 00:00:00\x01\n"; string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+
+	f.SetAutoDateDetection(true)
+	f.WriteField(midnight)
+	f.WriteTimestamp(later)
+	f.WriteField([]time.Time{midnight})
+	if out, expected := f.Row(), "2014-01-02\x012014-01-02 00:00:00.000000001\x012014-01-02\x01\n"; string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+}
+
+func TestRowWriterEscapeLineEnding(t *testing.T) {
+	f := NewRowWriter()
+	f.WriteString("a\nb")
+	if out, expected := f.Row(), "a\\nb\x01\n"; string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+
+	f.SetEscapeLineEnding(false)
+	f.WriteString("a\nb")
+	if err := f.Err(); err != nil {
+		t.Fatalf("Line endings shouldn't be rejected by default: %v", err)
+	}
+	if out, expected := f.Row(), "a\nb\x01\n"; string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+
+	f.SetRejectLineEnding(true)
+	f.WriteString("clean")
+	if err := f.Err(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	f.WriteString("a\nb")
+	if err := f.Err(); err == nil {
+		t.Fatal("Expected an error for an embedded line ending")
+	}
+}
+
+func TestWriteRatString(t *testing.T) {
+	f := NewRowWriter()
+	f.WriteRatString(big.NewRat(22, 7))
+	f.WriteField(big.NewRat(-4, 2))
+	f.WriteField((*big.Rat)(nil))
+	if out, expected := f.Row(), "22/7\x01-2\x01\x01\n"; string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+}
+
+func TestRowWriterColumnEncoding(t *testing.T) {
+	b := []byte{0xff, 0x00, 0xfe}
+	f := NewRowWriter()
+	f.SetColumnEncoding(1, HexEncoding)
+	f.WriteBytes(b)
+	f.WriteBytes(b)
+	f.WriteField([][]byte{b})
+	if out, expected := f.Row(), "/wD+\x01ff00fe\x01/wD+\x01\n"; string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+
+	f.SetBinaryEncoding(HexEncoding)
+	f.SetColumnEncoding(0, Base64Encoding)
+	f.WriteBytes(b)
+	f.WriteBytes(b)
+	f.WriteBytes(b)
+	if out, expected := f.Row(), "/wD+\x01ff00fe\x01ff00fe\x01\n"; string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+}
+
+func BenchmarkWriteLargeIntArray(b *testing.B) {
+	f := NewRowWriter()
+	array := make([]int, 10000)
+	for i := range array {
+		array[i] = i * 7919
+	}
+	m := map[string]int{}
+	for i := 0; i < 100; i++ {
+		m[strconv.Itoa(i)] = i * 7919
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.WriteIntArray(array)
+		f.WriteStrIntMap(m)
+		f.Reset()
+	}
+}
+
+func TestWriteFieldNullableString(t *testing.T) {
+	f := NewRowWriter()
+	f.SetNullString(`\N`)
+	f.SetCollectionNullString("null")
+	f.WriteField(NullableString{Value: "a\x01", Valid: true})
+	f.WriteField(NullableString{Value: "ignored"})
+	f.WriteField([]NullableString{{"b", true}, {}})
+	if out, expected := f.Row(), "a\\x01\x01\\N\x01b\x02null\x01\n"; string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+}
+
+func TestWriteFieldNullable(t *testing.T) {
+	ts := time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC)
+	f := NewRowWriter()
+	f.SetNullString(`\N`)
+	f.SetCollectionNullString("null")
+	fields := []interface{}{
+		Nullable[int]{Value: 42, Valid: true},
+		Nullable[int]{Value: 42},
+		Nullable[string]{Value: "a\x01", Valid: true},
+		Nullable[string]{},
+		Nullable[time.Time]{Value: ts, Valid: true},
+		Nullable[time.Time]{},
+		[]Nullable[int]{{1, true}, {}},
+	}
+	for _, v := range fields {
+		if !f.WriteField(v) {
+			t.Fatalf("WriteField failed on %T", v)
+		}
+	}
+	expected := "42\x01\\N\x01a\\x01\x01\\N\x012014-01-02 03:04:05\x01\\N\x011\x02null\x01\n"
+	if out := f.Row(); string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+}
+
+func TestWriteFieldNullableArray(t *testing.T) {
+	f := NewRowWriter()
+	f.SetNullString(`\N`)
+	f.SetCollectionNullString("null")
+	f.WriteField([]Nullable[string]{{"a\x02", true}, {}, {"", true}, {Value: "ignored"}})
+	f.WriteField([]Nullable[float64]{{}, {1.5, true}})
+	f.WriteField([]Nullable[string]{})
+	var nilArray []Nullable[string]
+	f.WriteField(nilArray)
+	expected := "a\\x02\x02null\x02\x02null\x01null\x021.500000\x01\x01\\N\x01\n"
+	if out := f.Row(); string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+}
+
+func TestSetFieldTransform(t *testing.T) {
+	f := NewRowWriter()
+	f.SetFieldTransform(func(col int, s string) string {
+		if col == 0 {
+			return strings.TrimSpace(s)
+		}
+		return s
+	})
+	f.WriteString("  a\x01 ")
+	f.WriteString(" b ")
+	f.WriteField([]string{" c "})
+	f.WriteField(time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC))
+	expected := "a\\x01\x01 b \x01 c \x012014-01-02 03:04:05\x01\n"
+	if out := f.Row(); string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+
+	// Transformed output is still escaped
+	f.SetFieldTransform(func(col int, s string) string { return s + "\x02" })
+	f.WriteStrArray([]string{"d", "e"})
+	if out, expected := f.Row(), "d\\x02\x02e\\x02\x01\n"; string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+func TestWriteFieldReader(t *testing.T) {
+	f := NewRowWriter()
+	long := strings.Repeat("x\x01", 40000)
+	if !f.WriteField(strings.NewReader("a\x01b\nc\\")) {
+		t.Fatal("WriteField failed on an io.Reader")
+	}
+	f.WriteField(strings.NewReader(long))
+	expected := "a\\x01b\\nc\\\\\x01" + strings.Repeat("x\\x01", 40000) + "\x01\n"
+	if out := f.Row(); string(out) != expected {
+		t.Errorf("Unexpected row: %q", out)
+	}
+
+	readErr := errors.New("boom")
+	f.WriteString("a")
+	f.WriteField(io.MultiReader(strings.NewReader("partial"), errReader{readErr}))
+	if err := f.Err(); !errors.Is(err, readErr) {
+		t.Fatalf("Expected read error but found: %v", err)
+	}
+	if out := f.Row(); string(out) != "a\x01partial\x01\n" {
+		t.Errorf("Unexpected row: %q", out)
+	}
+
+	// Runes split across reads are written whole
+	f.SetCharset(Latin1)
+	f.WriteField(iotest.OneByteReader(strings.NewReader("a\u00e9")))
+	if err := f.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if out, expected := f.Row(), "a\xe9\x01\n"; string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+	f.SetCharset(UTF8)
+
+	// The field transform applies to the whole value
+	f.SetFieldTransform(func(col int, s string) string { return strings.TrimSpace(s) })
+	f.WriteField(iotest.OneByteReader(strings.NewReader(" a b ")))
+	if out, expected := f.Row(), "a b\x01\n"; string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+}
+
+// Composes e followed by a combining acute accent, standing in for norm.NFC.
+type testNFC struct{}
+
+func (testNFC) String(s string) string { return strings.ReplaceAll(s, "e\u0301", "\u00e9") }
+
+func TestSetUnicodeNormalization(t *testing.T) {
+	decomposed, composed := "cafe\u0301\x01", "caf\u00e9\x01"
+	f := NewRowWriter()
+	f.WriteString(decomposed)
+	f.WriteString(composed)
+	if cols := f.DebugColumns(f.Row()); cols[0] == cols[1] {
+		t.Fatal("Strings shouldn't be normalized by default")
+	}
+
+	f.SetUnicodeNormalization(testNFC{})
+	f.WriteString(decomposed)
+	out := f.Row()
+	f.WriteString(composed)
+	if expected := f.Row(); !bytes.Equal(out, expected) {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+}
+
+func TestRowWriterUDelimiter(t *testing.T) {
+	f := NewRowWriter()
+	if err := f.SetDelimiters('U', '\x02', '\x03', '\n'); err == nil {
+		t.Fatal("U should be rejected while escaping is enabled")
+	}
+
+	if err := f.SetEscaping(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetDelimiters('U', '\x02', '\x03', '\n'); err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("a\\b")
+	f.WriteInt(1)
+	if out, expected := f.Row(), "a\\bU1U\n"; string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+
+	if err := f.SetEscaping(true); err == nil {
+		t.Fatal("Enabling escaping with a U delimiter should fail")
+	}
+}
+
+func TestWriteJSONArray(t *testing.T) {
+	docs := []json.RawMessage{
+		json.RawMessage(`{"a":1}`),
+		json.RawMessage("{\"b\":\"\x02\"}"),
+	}
+	expected := "{\"a\":1}\x02{\"b\":\"\\x02\"}\x01\n"
+
+	f := NewRowWriter()
+	f.WriteJSONArray(docs)
+	if out := f.Row(); string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+	f.WriteField(docs)
+	if out := f.Row(); string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+}
+
+func TestWriteStrArrayFunc(t *testing.T) {
+	f := NewRowWriter()
+	f.SetCollectionNullString(`\N`)
+	f.WriteStrArrayFunc(3, func(i int) (string, bool) {
+		return strconv.Itoa(i), i != 1
+	})
+	f.WriteStrArrayFunc(0, nil)
+	if out, expected := f.Row(), "0\x02\\N\x022\x01\x01\n"; string(out) != expected {
+		t.Errorf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+}
@@ -0,0 +1,488 @@
+package hadoopfiles
+
+import (
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// A Hive column type as it appears in DDL.
+type HiveType string
+
+const (
+	HiveTinyInt   HiveType = "TINYINT"
+	HiveSmallInt  HiveType = "SMALLINT"
+	HiveInt       HiveType = "INT"
+	HiveBigInt    HiveType = "BIGINT"
+	HiveFloat     HiveType = "FLOAT"
+	HiveDouble    HiveType = "DOUBLE"
+	HiveBoolean   HiveType = "BOOLEAN"
+	HiveString    HiveType = "STRING"
+	HiveTimestamp HiveType = "TIMESTAMP"
+	HiveDate      HiveType = "DATE"
+	HiveBinary    HiveType = "BINARY"
+	HiveDecimal   HiveType = "DECIMAL"
+)
+
+// Parses each raw string according to its column's Hive type, validates it,
+// and writes it with the matching writer, returning the completed row. Any
+// primitive type Schema.Validate accepts can be written: DECIMAL values must
+// fit the precision and scale, and VARCHAR and CHAR values the length. Empty
+// values of non-STRING columns are written as NULL. On error nothing is
+// written and the error identifies the offending column.
+func (w *RowWriter) WriteTypedRow(values []string, types []HiveType) ([]byte, error) {
+	if len(values) != len(types) {
+		return nil, fmt.Errorf("Mismatched row: %d values but %d types", len(values), len(types))
+	}
+	infos := make([]*typeInfo, len(types))
+	for i, t := range types {
+		info, err := parseHiveType(string(t))
+		if err != nil {
+			return nil, fmt.Errorf("Column %d: %v", i, err)
+		}
+		infos[i] = info
+	}
+	for i, v := range values {
+		if err := w.writeTyped(v, infos[i]); err != nil {
+			w.Reset()
+			return nil, fmt.Errorf("Column %d: %v", i, err)
+		}
+	}
+	if err := w.Err(); err != nil {
+		w.Reset()
+		return nil, err
+	}
+	return w.Row(), nil
+}
+
+// Parses a raw string as a value of a parsed type and writes it as a field.
+func (w *RowWriter) writeTyped(v string, info *typeInfo) error {
+	t := info.kind
+	if v == "" && t != HiveString {
+		w.WriteNull()
+		return nil
+	}
+	switch t {
+	case HiveTinyInt, HiveSmallInt, HiveInt, "INTEGER", HiveBigInt:
+		n, err := strconv.ParseInt(v, 10, info.goType.Bits())
+		if err != nil {
+			return fmt.Errorf("Invalid %s %q", t, v)
+		}
+		w.beginField()
+		w.writeInt(n)
+		w.endField()
+	case HiveFloat, HiveDouble:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("Invalid %s %q", t, v)
+		}
+		w.WriteFloat(f)
+	case HiveBoolean:
+		b, err := strconv.ParseBool(strings.ToLower(v))
+		if err != nil {
+			return fmt.Errorf("Invalid %s %q", t, v)
+		}
+		w.WriteBool(b)
+	case HiveString:
+		if info.params != nil && utf8.RuneCountInString(v) > info.params[0] {
+			return fmt.Errorf("Value longer than %s(%d): %q", info.declared, info.params[0], v)
+		}
+		w.WriteString(v)
+	case HiveDecimal:
+		if err := checkDecimal(v, info.params); err != nil {
+			return err
+		}
+		w.WriteString(v)
+	case HiveTimestamp:
+		ts, err := time.Parse(TimestampFormat, v)
+		if err != nil {
+			return fmt.Errorf("Invalid %s %q", t, v)
+		}
+		w.WriteTimestamp(ts)
+	case HiveDate:
+		if _, err := time.Parse(DateFormat, v); err != nil {
+			return fmt.Errorf("Invalid %s %q", t, v)
+		}
+		w.WriteString(v)
+	case HiveBinary:
+		b, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return fmt.Errorf("Invalid base64 %s %q", t, v)
+		}
+		w.WriteBytes(b)
+	default:
+		return fmt.Errorf("%s values can't be written from strings", t)
+	}
+	return nil
+}
+
+// Checks that v is a decimal number fitting DECIMAL with the given precision
+// and scale, which default to 10 and 0.
+func checkDecimal(v string, params []int) error {
+	precision, scale := 10, 0
+	if len(params) > 0 {
+		precision = params[0]
+	}
+	if len(params) > 1 {
+		scale = params[1]
+	}
+	digits := v
+	if digits[0] == '-' || digits[0] == '+' {
+		digits = digits[1:]
+	}
+	whole, frac, _ := strings.Cut(digits, ".")
+	valid := whole != "" || frac != ""
+	for _, c := range whole + frac {
+		valid = valid && c >= '0' && c <= '9'
+	}
+	if !valid {
+		return fmt.Errorf("Invalid DECIMAL %q", v)
+	}
+	if whole = strings.TrimLeft(whole, "0"); len(whole) > precision-scale || len(frac) > scale {
+		return fmt.Errorf("%q doesn't fit DECIMAL(%d,%d)", v, precision, scale)
+	}
+	return nil
+}
+
+// Splits a row into fields and decodes each according to its column's Hive
+// type: TINYINT, SMALLINT, INT, and BIGINT become int8, int16, int32, and
+// int64, FLOAT and DOUBLE float32 and float64, BOOLEAN bool, STRING (and
+// VARCHAR and CHAR) string, TIMESTAMP and DATE time.Time, BINARY []byte, and
+// DECIMAL a string, as written, so no precision is lost.
+// ARRAY<T> becomes a slice and MAP<K,V> a map of the element types, and
+// STRUCT a map[string]interface{} of its fields. Fields matching the null
+// token, empty non-STRING fields, and columns missing from the end of the row
+// are NULL and decoded as nil.
+func (r *RowReader) ReadTypedRow(row []byte, types []HiveType) ([]interface{}, error) {
+	infos := make([]*typeInfo, len(types))
+	for i, t := range types {
+		info, err := parseHiveType(string(t))
+		if err != nil {
+			return nil, fmt.Errorf("Column %d: %v", i, err)
+		}
+		infos[i] = info
+	}
+	raw, err := r.splitRow(row)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, len(types))
+	for i, info := range infos {
+		if i >= len(raw) {
+			break
+		}
+		v, err := r.decodeTyped(raw[i], info, 0)
+		if err != nil {
+			return nil, fmt.Errorf("Column %d: %v", i, err)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// Reads a row like ReadTypedRow but returns values database/sql drivers
+// accept, for loading rows into other databases: integers become int64,
+// floats float64, and ARRAYs, MAPs, and STRUCTs JSON strings. NULLs are nil.
+func (r *RowReader) ReadDriverValues(row []byte, types []HiveType) ([]driver.Value, error) {
+	values, err := r.ReadTypedRow(row, types)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]driver.Value, len(values))
+	for i, v := range values {
+		if out[i], err = driverValue(v); err != nil {
+			return nil, fmt.Errorf("Column %d: %v", i, err)
+		}
+	}
+	return out, nil
+}
+
+// Converts a value returned by ReadTypedRow to a driver.Value.
+func driverValue(v interface{}) (driver.Value, error) {
+	switch v := v.(type) {
+	case nil, string, bool, time.Time, []byte, int64, float64:
+		return v, nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case float32:
+		// Converting directly would add digits the FLOAT never had
+		return strconv.ParseFloat(strconv.FormatFloat(float64(v), 'g', -1, 32), 64)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// A parsed Hive type.
+type typeInfo struct {
+	kind   HiveType // a primitive type, or ARRAY, MAP, or STRUCT
+	goType reflect.Type
+
+	declared HiveType  // VARCHAR or CHAR, whose kind is STRING
+	params   []int     // of DECIMAL, VARCHAR, or CHAR
+	key      *typeInfo // MAP key
+	elem     *typeInfo // ARRAY element or MAP value
+
+	// STRUCT fields
+	names  []string
+	fields []*typeInfo
+}
+
+// The Go types of primitive Hive types.
+var primitiveGoTypes = map[HiveType]reflect.Type{
+	HiveTinyInt:   reflect.TypeOf(int8(0)),
+	HiveSmallInt:  reflect.TypeOf(int16(0)),
+	HiveInt:       reflect.TypeOf(int32(0)),
+	"INTEGER":     reflect.TypeOf(int32(0)),
+	HiveBigInt:    reflect.TypeOf(int64(0)),
+	HiveFloat:     reflect.TypeOf(float32(0)),
+	HiveDouble:    reflect.TypeOf(float64(0)),
+	HiveBoolean:   reflect.TypeOf(false),
+	HiveString:    reflect.TypeOf(""),
+	"VARCHAR":     reflect.TypeOf(""),
+	"CHAR":        reflect.TypeOf(""),
+	HiveTimestamp: timeType,
+	HiveDate:      timeType,
+	HiveBinary:    reflect.TypeOf([]byte(nil)),
+	HiveDecimal:   reflect.TypeOf(""), // as written, to avoid losing precision
+}
+
+var structMapType = reflect.TypeOf(map[string]interface{}(nil))
+
+// Parses a Hive type such as BIGINT or MAP<STRING,ARRAY<INT>>.
+func parseHiveType(s string) (*typeInfo, error) {
+	s = strings.TrimSpace(s)
+	open := strings.IndexByte(s, '<')
+	if open < 0 {
+		name, params, err := parseTypeParams(strings.ToUpper(s))
+		if err != nil {
+			return nil, err
+		}
+		t, ok := primitiveGoTypes[HiveType(name)]
+		if !ok {
+			return nil, fmt.Errorf("Unsupported type %s", s)
+		}
+		if err := checkTypeParams(HiveType(name), params); err != nil {
+			return nil, fmt.Errorf("Invalid type %s: %v", s, err)
+		}
+		info := &typeInfo{kind: HiveType(name), goType: t, params: params}
+		if name == "VARCHAR" || name == "CHAR" {
+			info.kind, info.declared = HiveString, HiveType(name)
+		}
+		return info, nil
+	}
+	if !strings.HasSuffix(s, ">") {
+		return nil, fmt.Errorf("Invalid type %s", s)
+	}
+	name := HiveType(strings.ToUpper(strings.TrimSpace(s[:open])))
+	args := splitTypeArgs(s[open+1 : len(s)-1])
+	info := &typeInfo{kind: name}
+	var err error
+	switch name {
+	case "ARRAY":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("Invalid type %s", s)
+		}
+		if info.elem, err = parseHiveType(args[0]); err != nil {
+			return nil, err
+		}
+		info.goType = reflect.SliceOf(info.elem.goType)
+	case "MAP":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("Invalid type %s", s)
+		}
+		if info.key, err = parseHiveType(args[0]); err != nil {
+			return nil, err
+		}
+		if !info.key.goType.Comparable() || info.key.key != nil || info.key.elem != nil {
+			return nil, fmt.Errorf("Unsupported map key type %s", args[0])
+		}
+		if info.elem, err = parseHiveType(args[1]); err != nil {
+			return nil, err
+		}
+		info.goType = reflect.MapOf(info.key.goType, info.elem.goType)
+	case "STRUCT":
+		for _, arg := range args {
+			i := strings.IndexByte(arg, ':')
+			if i < 0 {
+				return nil, fmt.Errorf("Invalid struct field %s", arg)
+			}
+			f, err := parseHiveType(arg[i+1:])
+			if err != nil {
+				return nil, err
+			}
+			info.names = append(info.names, strings.TrimSpace(arg[:i]))
+			info.fields = append(info.fields, f)
+		}
+		info.goType = structMapType
+	default:
+		return nil, fmt.Errorf("Unsupported type %s", s)
+	}
+	return info, nil
+}
+
+// Splits a primitive type such as DECIMAL(10,2) into its name and integer
+// parameters.
+func parseTypeParams(s string) (string, []int, error) {
+	open := strings.IndexByte(s, '(')
+	if open < 0 {
+		return s, nil, nil
+	}
+	if !strings.HasSuffix(s, ")") {
+		return "", nil, fmt.Errorf("Invalid type %s", s)
+	}
+	var params []int
+	for _, p := range strings.Split(s[open+1:len(s)-1], ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return "", nil, fmt.Errorf("Invalid type %s", s)
+		}
+		params = append(params, n)
+	}
+	return strings.TrimSpace(s[:open]), params, nil
+}
+
+// Checks the parameters of a primitive type against Hive's limits.
+func checkTypeParams(name HiveType, params []int) error {
+	switch name {
+	case HiveDecimal:
+		// DECIMAL defaults to DECIMAL(10,0)
+		if len(params) > 2 {
+			return fmt.Errorf("DECIMAL takes a precision and scale")
+		}
+		if len(params) > 0 && (params[0] < 1 || params[0] > 38) {
+			return fmt.Errorf("DECIMAL precision must be from 1 to 38")
+		}
+		if len(params) == 2 && (params[1] < 0 || params[1] > params[0]) {
+			return fmt.Errorf("DECIMAL scale must be from 0 to the precision")
+		}
+	case "VARCHAR":
+		if len(params) != 1 || params[0] < 1 || params[0] > 65535 {
+			return fmt.Errorf("VARCHAR length must be from 1 to 65535")
+		}
+	case "CHAR":
+		if len(params) != 1 || params[0] < 1 || params[0] > 255 {
+			return fmt.Errorf("CHAR length must be from 1 to 255")
+		}
+	default:
+		if params != nil {
+			return fmt.Errorf("%s takes no parameters", name)
+		}
+	}
+	return nil
+}
+
+// Splits the comma separated arguments of a complex type, ignoring commas
+// nested in further type arguments.
+func splitTypeArgs(s string) []string {
+	var args []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '<', '(':
+			depth++
+		case '>', ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				args = append(args, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(args, s[start:])
+}
+
+// Decodes raw, a value of type info at a nesting level. Returns nil for NULL.
+func (r *RowReader) decodeTyped(raw []byte, info *typeInfo, level int) (interface{}, error) {
+	if string(raw) == r.nullString || (len(raw) == 0 && info.kind != HiveString) {
+		return nil, nil
+	}
+	v := reflect.New(info.goType).Elem()
+	if err := r.decodeTypedValue(raw, info, v, level); err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
+
+// Decodes raw, a non-NULL value of type info at a nesting level, into v.
+// NULL elements of ARRAYs and MAPs are decoded as their zero value.
+func (r *RowReader) decodeTypedValue(raw []byte, info *typeInfo, v reflect.Value, level int) error {
+	switch info.kind {
+	case "ARRAY":
+		delim, err := r.delimiter(level + 1)
+		if err != nil {
+			return err
+		}
+		items := r.splitItems(raw, delim)
+		s := reflect.MakeSlice(info.goType, len(items), len(items))
+		for i, item := range items {
+			if err := r.decodeTypedValue(item, info.elem, s.Index(i), level+1); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+	case "MAP":
+		itemDelim, err := r.delimiter(level + 1)
+		if err != nil {
+			return err
+		}
+		keyDelim, err := r.delimiter(level + 2)
+		if err != nil {
+			return err
+		}
+		m := reflect.MakeMap(info.goType)
+		for _, entry := range r.splitItems(raw, itemDelim) {
+			i := r.index(entry, keyDelim)
+			if i < 0 {
+				return fmt.Errorf("Map entry without a key delimiter: %q", entry)
+			}
+			k, val := reflect.New(info.key.goType).Elem(), reflect.New(info.elem.goType).Elem()
+			if err := r.decodeTypedValue(entry[:i], info.key, k, level+2); err != nil {
+				return err
+			}
+			if err := r.decodeTypedValue(entry[i+1:], info.elem, val, level+2); err != nil {
+				return err
+			}
+			m.SetMapIndex(k, val)
+		}
+		v.Set(m)
+	case "STRUCT":
+		if len(raw) == 0 {
+			return nil
+		}
+		delim, err := r.delimiter(level + 1)
+		if err != nil {
+			return err
+		}
+		items := r.splitItems(raw, delim)
+		m := make(map[string]interface{}, len(info.names))
+		for i, name := range info.names {
+			if i >= len(items) {
+				m[name] = nil
+				continue
+			}
+			f, err := r.decodeTyped(items[i], info.fields[i], level+1)
+			if err != nil {
+				return fmt.Errorf("Field %s: %v", name, err)
+			}
+			m[name] = f
+		}
+		v.Set(reflect.ValueOf(m))
+	default:
+		return r.decodeValue(raw, v, level)
+	}
+	return nil
+}
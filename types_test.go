@@ -0,0 +1,158 @@
+package hadoopfiles
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWriteTypedRow(t *testing.T) {
+	f := NewRowWriter()
+	types := []HiveType{HiveInt, HiveTimestamp, HiveString, HiveDouble}
+
+	out, err := f.WriteTypedRow([]string{"42", "2014-01-02 03:04:05.5", "x\x01", ""}, types)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte("42\x012014-01-02 03:04:05.5\x01x\\x01\x01\x01\n")
+	if !bytes.Equal(out, expected) {
+		t.Fatalf("Expected: %q !=\nActual:  %q", expected, out)
+	}
+
+	for _, bad := range [][]string{
+		{"4x2", "2014-01-02 03:04:05", "", ""},
+		{"3000000000", "2014-01-02 03:04:05", "", ""},
+		{"1", "yesterday", "", ""},
+	} {
+		if _, err := f.WriteTypedRow(bad, types); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+	if out := f.Row(); !bytes.Equal(out, []byte("\n")) {
+		t.Fatalf("Nothing should be written on error: %q", out)
+	}
+}
+
+func TestReadTypedRow(t *testing.T) {
+	w := NewRowWriter()
+	ts := time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC)
+	w.WriteInt(-7)
+	w.WriteTimestamp(ts)
+	w.WriteString("a\x01b")
+	w.WriteNull()
+	w.WriteIntArray([]int{1, 2})
+	w.WriteStrIntMap(map[string]int{"x": 3})
+	w.WriteField(struct {
+		Name string
+		OK   bool
+	}{"n", true})
+	w.WriteBytes([]byte{0xff})
+	w.WriteFloat(1.5)
+	row := w.Row()
+
+	types := []HiveType{HiveBigInt, HiveTimestamp, "varchar(10)", HiveInt, "ARRAY<INT>",
+		"MAP<STRING,BIGINT>", "STRUCT<name:STRING,ok:BOOLEAN>", HiveBinary, HiveFloat, HiveString}
+	values, err := NewRowReader().ReadTypedRow(row, types)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{
+		int64(-7),
+		ts,
+		"a\x01b",
+		nil,
+		[]int32{1, 2},
+		map[string]int64{"x": 3},
+		map[string]interface{}{"name": "n", "ok": true},
+		[]byte{0xff},
+		float32(1.5),
+		nil, // missing from the row
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected: %#v\nActual:   %#v", expected, values)
+	}
+
+	for _, typ := range []HiveType{"DECIMAL(40,2)", "VARCHAR", "INT(3)", "ARRAY<INT", "MAP<BINARY,INT>", "MAP<INT>"} {
+		if _, err := NewRowReader().ReadTypedRow(row, []HiveType{typ}); err == nil {
+			t.Errorf("Expected an error for type %s", typ)
+		}
+	}
+	if _, err := NewRowReader().ReadTypedRow([]byte("x\x01"), []HiveType{HiveInt}); err == nil {
+		t.Error("Expected an error for an invalid INT")
+	}
+}
+
+func TestReadDriverValues(t *testing.T) {
+	w := NewRowWriter()
+	ts := time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC)
+	w.WriteInt(7)
+	w.WriteFloat(1.1)
+	w.WriteTimestamp(ts)
+	w.WriteNull()
+	w.WriteStrIntMap(map[string]int{"a": 1})
+	w.WriteBytes([]byte("x"))
+	values, err := NewRowReader().ReadDriverValues(w.Row(),
+		[]HiveType{HiveSmallInt, HiveFloat, HiveTimestamp, HiveString, "MAP<STRING,INT>", HiveBinary})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []driver.Value{int64(7), 1.1, ts, nil, `{"a":1}`, []byte("x")}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected: %#v\nActual:   %#v", expected, values)
+	}
+	for i, v := range values {
+		if v != nil && !driver.IsValue(v) {
+			t.Errorf("Column %d isn't a driver.Value: %T", i, v)
+		}
+	}
+}
+
+func TestWriteTypedRowSchema(t *testing.T) {
+	schema, err := SchemaOf(struct {
+		N uint64
+		S string
+	}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema.Columns = append(schema.Columns,
+		Column{"price", "DECIMAL(5,2)"}, Column{"code", "VARCHAR(3)"},
+		Column{"flag", "CHAR(1)"}, Column{"n32", "INTEGER"})
+	if err := schema.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	w, err := schema.NewWriter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := []string{"18446744073709551615", "a\x01", "-123.45", "abc", "y", "-7"}
+	row, err := w.WriteTypedRow(values, schema.Types())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := schema.NewReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := r.ReadTypedRow(row, schema.Types())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{"18446744073709551615", "a\x01", "-123.45", "abc", "y", int32(-7)}
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("Expected: %#v !=\nActual:  %#v", expected, out)
+	}
+
+	for i, bad := range map[int]string{0: "1e3", 2: "1234.5", 3: "abcd", 4: "yn"} {
+		invalid := append([]string(nil), values...)
+		invalid[i] = bad
+		if _, err := w.WriteTypedRow(invalid, schema.Types()); err == nil {
+			t.Errorf("Expected an error for %q as %s", bad, schema.Columns[i].Type)
+		}
+	}
+	if _, err := w.WriteTypedRow([]string{"1"}, []HiveType{"ARRAY<INT>"}); err == nil {
+		t.Error("Expected an error writing an ARRAY from a string")
+	}
+}